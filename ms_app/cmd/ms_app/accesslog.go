@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// jsonLog пишет структурированные записи по одной JSON-строке (без префикса log)
+var jsonLog = log.New(os.Stdout, "", 0)
+
+// debugLogging (LOG_DEBUG) включает отладочные сообщения debugf
+var debugLogging = envBool("LOG_DEBUG", false)
+
+func debugf(format string, args ...interface{}) {
+	if debugLogging {
+		log.Printf("🐛 "+format, args...)
+	}
+}
+
+// requestStats — данные запроса, которые собираются по ходу обработки
+type requestStats struct {
+	requestID    string
+	dbNanos      atomic.Int64
+	dbQueries    atomic.Int32
+	queryTimeout atomic.Int64                   // таймаут из queryContext, для логов
+	dbRole       string                         // "read" / "write": какой пул выдали readDB/writeDB
+	breaker      atomic.Pointer[circuitBreaker] // breaker пула последнего acquireConn
+}
+
+type accessEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id"`
+	ClientIP   string  `json:"client_ip"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	DBMs       float64 `json:"db_ms"`
+	DBQueries  int32   `json:"db_queries"`
+	DBRole     string  `json:"db_role,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+}
+
+func requestStatsFrom(ctx context.Context) *requestStats {
+	stats, _ := ctx.Value(requestStatsKey).(*requestStats)
+	return stats
+}
+
+func requestID(ctx context.Context) string {
+	if stats := requestStatsFrom(ctx); stats != nil {
+		return stats.requestID
+	}
+	return ""
+}
+
+// statusRecorder запоминает код ответа и размер тела
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withAccessLog логирует запрос в JSON: общее время, время в БД, request ID
+// (из X-Request-ID от Nginx или сгенерированный) и IP клиента
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		stats := &requestStats{requestID: id}
+		rec := &statusRecorder{ResponseWriter: w}
+
+		ctx := context.WithValue(r.Context(), requestStatsKey, stats)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		entry := accessEntry{
+			Time:       start.Format(time.RFC3339Nano),
+			RequestID:  id,
+			ClientIP:   clientIP(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMs: durationMs(time.Since(start)),
+			DBMs:       durationMs(time.Duration(stats.dbNanos.Load())),
+			DBQueries:  stats.dbQueries.Load(),
+			DBRole:     stats.dbRole,
+			UserAgent:  r.UserAgent(),
+		}
+
+		recordRoleMetrics(stats)
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Failed to encode access log entry: %v", err)
+			return
+		}
+		jsonLog.Println(string(line))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Прокси, которым доверяем заголовки X-Forwarded-For/X-Real-IP.
+// По умолчанию — loopback и приватные сети (Nginx в docker-сети).
+var trustedProxies = parseCIDRs(envOrDefault("TRUSTED_PROXIES",
+	"127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"))
+
+func parseCIDRs(raw string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			log.Printf("⚠️  Invalid CIDR %q: %v", s, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP определяет IP клиента. Заголовки прокси учитываются только если
+// запрос пришёл от доверенного прокси. С PROXY protocol адрес соединения
+// уже принадлежит клиенту. Unix-сокет (LISTEN_SOCKET) доступен только
+// локальному Nginx, поэтому его пир считается доверенным прокси.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if proxyProtocol {
+		return host
+	}
+
+	if !viaUnixSocket(r) {
+		remote := net.ParseIP(host)
+		if remote == nil || !isTrustedProxy(remote) {
+			return host
+		}
+	}
+
+	// Идём справа налево и берём первый адрес, который не является нашим прокси
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		parts := strings.Split(xff, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			candidate := strings.TrimSpace(parts[i])
+			ip := net.ParseIP(candidate)
+			if ip != nil && !isTrustedProxy(ip) {
+				return candidate
+			}
+		}
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+
+	return host
+}
+
+// viaUnixSocket — запрос принят на Unix-сокете: RemoteAddr там "@", а не IP
+func viaUnixSocket(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
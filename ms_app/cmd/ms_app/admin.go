@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// adminPort (ADMIN_PORT) — внутренний порт для /metrics и /diag/*. Его не
+// публикуют через Nginx; если не задан, всё обслуживается на основном порту.
+var adminPort = getenv("ADMIN_PORT")
+
+// startAdminServer поднимает второй http.Server для admin-маршрутов.
+// Останавливается по тому же SIGINT/SIGTERM, что и основной.
+func startAdminServer(mux *http.ServeMux) {
+	ln, err := listenConfig().Listen(context.Background(), "tcp", ":"+adminPort)
+	if err != nil {
+		log.Fatalf("💥 Failed to start admin server: %v", err)
+	}
+
+	log.Printf("🔧 Admin endpoints (/metrics, /dashboard, /diag/*) available at: http://0.0.0.0:%s", adminPort)
+	if debugEndpoints {
+		log.Println("🐛 DEBUG enabled: /debug/echo is available on the admin port")
+	}
+
+	if envBool("ENABLE_PPROF", false) {
+		registerPprof(mux)
+	}
+
+	srv := &http.Server{
+		Handler:        withServedBy(withRecovery(withAdminAllowlist(mux))),
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	go func() {
+		if err := serve(srv, ln); err != nil {
+			log.Printf("❌ Admin server failed: %v", err)
+		}
+	}()
+}
+
+// adminAllowedIPs (ADMIN_ALLOWED_IPS) — сети, которым открыт admin-порт.
+// Смотрим только на адрес соединения: заголовкам прокси здесь не доверяем.
+// По умолчанию только loopback: из приватных сетей приходит и Nginx/HAProxy
+// в docker-сети, а за ним — любой клиент из интернета.
+var adminAllowedIPs = parseCIDRs(envOrDefault("ADMIN_ALLOWED_IPS", "127.0.0.0/8,::1/128"))
+
+func withAdminAllowlist(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		ip := net.ParseIP(host)
+		for _, n := range adminAllowedIPs {
+			if ip != nil && n.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		log.Printf("🚫 Admin request from %s rejected (not in ADMIN_ALLOWED_IPS)", host)
+		writeError(w, http.StatusForbidden, errCodeForbidden, "forbidden")
+	})
+}
+
+// registerPprof (ENABLE_PPROF) добавляет net/http/pprof на admin-порт, чтобы
+// снимать CPU/heap-профили во время нагрузочных тестов
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	log.Println("🔬 pprof enabled on admin port at /debug/pprof/")
+}
+
+// EchoResponse — запрос глазами приложения, для отладки заголовков прокси
+type EchoResponse struct {
+	Method     string              `json:"method"`
+	Host       string              `json:"host"`
+	URI        string              `json:"uri"`
+	Proto      string              `json:"proto"`
+	RemoteAddr string              `json:"remote_addr"`
+	ClientIP   string              `json:"client_ip"`
+	Headers    map[string][]string `json:"headers"`
+}
+
+// echoHandler — /debug/echo: что на самом деле передали HAProxy/Nginx
+// (X-Forwarded-For, X-Real-IP, Host) и какой IP клиента из этого вышел
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, EchoResponse{
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		ClientIP:   clientIP(r),
+		Headers:    r.Header,
+	})
+}
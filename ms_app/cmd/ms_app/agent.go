@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	// degraded — приложение запущено без БД
+	degraded atomic.Bool
+	// maintenance — инстанс выводится из балансировки (SIGUSR1 переключает)
+	maintenance atomic.Bool
+)
+
+// agentState — ответ для HAProxy agent-check
+func agentState() string {
+	switch {
+	case maintenance.Load():
+		return "drain"
+	case degraded.Load() || !ready.Load():
+		return "down"
+	default:
+		return "up"
+	}
+}
+
+// startAgentCheck поднимает TCP listener для HAProxy agent-check на AGENT_CHECK_PORT.
+// HAProxy подключается, читает одну строку ("up"/"drain"/"down") и закрывает соединение.
+func startAgentCheck() {
+	port := getenv("AGENT_CHECK_PORT")
+	if port == "" {
+		return
+	}
+
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Printf("⚠️  Could not start agent-check listener on port %s: %v", port, err)
+		return
+	}
+
+	log.Printf("🩺 HAProxy agent-check listening on port %s", port)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Printf("Agent-check accept failed: %v", err)
+				return
+			}
+
+			go func(c net.Conn) {
+				defer c.Close()
+				c.SetWriteDeadline(time.Now().Add(2 * time.Second))
+				c.Write([]byte(agentState() + "\n"))
+			}(conn)
+		}
+	}()
+}
+
+// watchMaintenanceSignal переключает режим обслуживания по SIGUSR1
+func watchMaintenanceSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+
+	go func() {
+		for range sigs {
+			enabled := !maintenance.Load()
+			maintenance.Store(enabled)
+			log.Printf("🔧 Maintenance mode: %v (agent-check reports %q)", enabled, agentState())
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultBatchMaxSize = 1000
+
+var errUserLimitReached = errors.New("user limit reached")
+
+// UserInput — пользователь во входящем JSON
+type UserInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// batchCreateHandler создаёт пользователей из JSON-массива одной транзакцией:
+// либо создаются все, либо ни один. Заголовок X-Inserted-Count — сколько создано.
+// С ?partial=true каждый элемент обрабатывается отдельно (writePartialBatch).
+func batchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	if dryRun {
+		writeError(w, http.StatusServiceUnavailable, errCodeReadOnly, "Service is in read-only mode (DB_DRY_RUN)")
+		return
+	}
+
+	pool := writeDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	if partialRequested(r) {
+		writePartialBatch(w, r, pool, createBatchItem)
+		return
+	}
+
+	inputs, ok := readBatch(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	var users []User
+	err := withPinnedUserLimitTx(ctx, pool, func(tx *sql.Tx) error {
+		users = nil // транзакция может повторяться
+		if err := checkUserLimit(ctx, tx, len(inputs)); err != nil {
+			return err
+		}
+
+		for _, chunk := range batchChunks(inputs) {
+			query, args := batchInsertQuery(chunk)
+			inserted, err := insertChunk(ctx, tx, query, args)
+			if err != nil {
+				return err
+			}
+			users = append(users, inserted...)
+		}
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, errUserLimitReached) {
+			writeError(w, http.StatusInsufficientStorage, errCodeUserLimit,
+				fmt.Sprintf("User limit of %d reached", maxUsers))
+		} else if pqErr, ok := uniqueViolation(err); ok {
+			writeDuplicateError(w, pqErr)
+		} else {
+			writeDBError(w, r, err, "Failed to create users")
+		}
+		return
+	}
+
+	markWrite(w)
+	emitUserEvent(eventUserCreated, users...)
+	w.Header().Set("X-Inserted-Count", strconv.Itoa(len(users)))
+	writeJSON(w, http.StatusCreated, users)
+}
+
+func insertChunk(ctx context.Context, tx *sql.Tx, query string, args []interface{}) ([]User, error) {
+	rows, err := dbQuery(ctx, tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// PostgreSQL принимает не больше 65535 параметров на запрос, у строки пакета их 2
+const maxBatchChunkSize = 65535 / 2
+
+// batchChunkSize (BATCH_CHUNK_SIZE) — сколько строк в одном INSERT. Большой пакет
+// режется на несколько запросов внутри той же транзакции.
+var batchChunkSize = envInt("BATCH_CHUNK_SIZE", 1000)
+
+// batchChunks делит пакет на части по batchChunkSize строк
+func batchChunks(inputs []UserInput) [][]UserInput {
+	size := batchChunkSize
+	if size <= 0 || size > maxBatchChunkSize {
+		size = maxBatchChunkSize
+	}
+
+	var chunks [][]UserInput
+	for len(inputs) > size {
+		chunks = append(chunks, inputs[:size])
+		inputs = inputs[size:]
+	}
+	return append(chunks, inputs)
+}
+
+// readBatch разбирает JSON-массив пользователей, проверяет размер пакета
+// (BATCH_MAX_SIZE) и обязательные поля. При ошибке ответ уже записан.
+func readBatch(w http.ResponseWriter, r *http.Request) ([]UserInput, bool) {
+	inputs, ok := readBatchInputs(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	for i := range inputs {
+		if e := validateUserInput(&inputs[i]); e != nil {
+			e.Error = fmt.Sprintf("Item %d: %s", i, e.Error)
+			writeJSON(w, http.StatusBadRequest, e)
+			return nil, false
+		}
+	}
+
+	return inputs, true
+}
+
+// readBatchInputs разбирает JSON-массив и проверяет только размер пакета
+func readBatchInputs(w http.ResponseWriter, r *http.Request) ([]UserInput, bool) {
+	var inputs []UserInput
+	if err := decodeJSON(r, &inputs); err != nil {
+		writeDecodeError(w, err)
+		return nil, false
+	}
+
+	maxSize := envInt("BATCH_MAX_SIZE", defaultBatchMaxSize)
+	if len(inputs) == 0 || len(inputs) > maxSize {
+		writeError(w, http.StatusBadRequest, errCodeValidation,
+			fmt.Sprintf("Batch must contain between 1 and %d users", maxSize))
+		return nil, false
+	}
+
+	return inputs, true
+}
+
+// validateUserInput нормализует email и проверяет элемент пакета.
+// Возвращает описание ошибки или nil.
+func validateUserInput(in *UserInput) *ErrorResponse {
+	in.Email = normalizeEmail(in.Email)
+	if in.Name == "" || in.Email == "" {
+		return &ErrorResponse{Error: "name and email are required", Code: errCodeValidation}
+	}
+
+	fields := map[string]string{"name": in.Name, "email": in.Email}
+	if errs := fieldLengthErrors(fields); errs != nil {
+		return &ErrorResponse{Error: msgFieldTooLong, Code: errCodeValidation, Details: errs}
+	}
+	if errs := junkFieldErrors(fields); errs != nil {
+		return &ErrorResponse{Error: msgFieldJunk, Code: errCodeValidation, Details: errs}
+	}
+
+	return nil
+}
+
+// batchInsertQuery строит многострочный INSERT ... VALUES ($1, $2), ($3, $4), ...
+func batchInsertQuery(inputs []UserInput) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO users (name, email) VALUES ")
+	args := writeBatchValues(&sb, inputs)
+	sb.WriteString(" RETURNING " + userColumns)
+
+	return sb.String(), args
+}
+
+// writeBatchValues дописывает в sb список ($1, $2), ($3, $4), ... и возвращает аргументы
+func writeBatchValues(sb *strings.Builder, inputs []UserInput) []interface{} {
+	args := make([]interface{}, 0, len(inputs)*2)
+	for i, in := range inputs {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(sb, "($%d, $%d)", len(args)+1, len(args)+2)
+		args = append(args, in.Name, in.Email)
+	}
+	return args
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errCircuitOpen — обращения к БД временно не выполняются
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker: после threshold подряд неудачных обращений к БД (недоступна,
+// таймаут, обрыв соединения) обработчики сразу отвечают 503 в течение cooldown,
+// затем пропускается один пробный запрос. Успех закрывает breaker, неудача —
+// открывает снова. threshold == 0 выключает breaker.
+// Breaker свой у каждого пула: отказ пула тенанта или реплики не должен
+// открывать circuit для основной БД.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string // имя пула для логов
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probeAt   time.Time
+}
+
+var (
+	breakerThreshold = envInt("DB_BREAKER_THRESHOLD", 5)
+	breakerCooldown  = envDuration("DB_BREAKER_COOLDOWN", 30*time.Second)
+
+	breakersMu sync.Mutex
+	breakers   = map[*sql.DB]*circuitBreaker{}
+)
+
+// breakerFor возвращает breaker пула, создавая его при первом обращении
+func breakerFor(pool *sql.DB) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[pool]
+	if !ok {
+		b = &circuitBreaker{name: poolName(pool), threshold: breakerThreshold, cooldown: breakerCooldown}
+		breakers[pool] = b
+	}
+	return b
+}
+
+// poolName — имя пула как в namedPools, для пулов тенантов — tenant-<id>
+func poolName(pool *sql.DB) string {
+	for _, p := range namedPools() {
+		if p.db == pool {
+			return p.name
+		}
+	}
+
+	tenantPoolsMu.Lock()
+	defer tenantPoolsMu.Unlock()
+	for tenant, p := range tenantPools {
+		if p == pool {
+			return "tenant-" + tenant
+		}
+	}
+	return "unknown"
+}
+
+// queryBreaker — breaker, которому сообщается результат запроса через q:
+// для пула — его собственный, для соединения и транзакции — breaker пула,
+// из которого acquireConn выдал соединение в этом запросе. nil — не учитывать.
+func queryBreaker(ctx context.Context, q queryer) *circuitBreaker {
+	if pool, ok := q.(*sql.DB); ok {
+		return breakerFor(pool)
+	}
+	if stats := requestStatsFrom(ctx); stats != nil {
+		return stats.breaker.Load()
+	}
+	return nil
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probeAt = time.Now()
+		log.Printf("🟡 DB circuit breaker for pool %s half-open, sending a trial request", b.name)
+		return true
+	case breakerHalfOpen:
+		// Пробный запрос ещё выполняется; если он так и не отчитался — пускаем следующий
+		if time.Since(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+// record учитывает результат обращения к БД. Таймаут, который клиент сам
+// задал через X-Query-Timeout, ничего не говорит о состоянии БД и не считается.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	if _, clientTimeout := ctx.Value(queryTimeoutKey).(time.Duration); clientTimeout && errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	failure, relevant := classifyDBError(err)
+	if !relevant {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failure {
+		if b.state != breakerClosed {
+			log.Printf("🟢 DB circuit breaker for pool %s closed, database is responding", b.name)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		log.Printf("🔴 DB circuit breaker for pool %s open after %d consecutive failures, cooling down for %v", b.name, b.failures, b.cooldown)
+	}
+}
+
+func (b *circuitBreaker) retryAfterSeconds() int {
+	if b == nil {
+		return 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	remaining := b.cooldown - time.Since(b.openedAt)
+	if remaining < time.Second {
+		return 1
+	}
+	return int(math.Ceil(remaining.Seconds()))
+}
+
+// classifyDBError решает, говорит ли ошибка о недоступности БД.
+// relevant == false — результат не учитывается (например, клиент отменил запрос).
+func classifyDBError(err error) (failure, relevant bool) {
+	switch {
+	case err == nil, errors.Is(err, sql.ErrNoRows), errors.Is(err, sql.ErrTxDone):
+		return false, true
+	case errors.Is(err, context.Canceled):
+		return false, false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true, true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 08 — ошибки соединения, 53 — нехватка ресурсов, 57P — сервер останавливается
+		code := string(pqErr.Code)
+		unavailable := strings.HasPrefix(code, "08") || strings.HasPrefix(code, "53") || strings.HasPrefix(code, "57P")
+		return unavailable, true
+	}
+
+	// Сетевые ошибки, обрыв соединения и т.п.
+	return true, true
+}
@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+// Clock — источник времени для ретраев и пауз. В коде используется через
+// переменную clock, чтобы backoff можно было прогнать без реальных задержек.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var clock Clock = realClock{}
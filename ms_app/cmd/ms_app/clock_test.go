@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakeClock не ждёт: Sleep и After сдвигают время и запоминают паузы
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// useFakeClock подменяет clock на время теста
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	fake := newFakeClock()
+	prev := clock
+	clock = fake
+	t.Cleanup(func() { clock = prev })
+	return fake
+}
+
+func TestConnectWithRetryBackoff(t *testing.T) {
+	fake := useFakeClock(t)
+
+	prev := connectDB
+	t.Cleanup(func() { connectDB = prev })
+
+	attempts := 0
+	connectDB = func() error {
+		attempts++
+		return errors.New("connection refused")
+	}
+
+	if err := connectWithRetry(4); err == nil {
+		t.Fatal("connectWithRetry succeeded, want error")
+	}
+
+	if attempts != 4 {
+		t.Fatalf("attempts = %d, want 4", attempts)
+	}
+
+	// После последней попытки паузы нет
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second}
+	if !reflect.DeepEqual(fake.sleeps, want) {
+		t.Fatalf("backoff = %v, want %v", fake.sleeps, want)
+	}
+}
+
+func TestConnectWithRetryStopsOnSuccess(t *testing.T) {
+	fake := useFakeClock(t)
+
+	prev := connectDB
+	t.Cleanup(func() { connectDB = prev })
+
+	attempts := 0
+	connectDB = func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	if err := connectWithRetry(12); err != nil {
+		t.Fatalf("connectWithRetry: %v", err)
+	}
+
+	want := []time.Duration{5 * time.Second, 10 * time.Second}
+	if !reflect.DeepEqual(fake.sleeps, want) {
+		t.Fatalf("backoff = %v, want %v", fake.sleeps, want)
+	}
+}
+
+func TestConnectWithRetryPermanentError(t *testing.T) {
+	if !dbFailFast {
+		t.Skip("DB_FAIL_FAST=false")
+	}
+	fake := useFakeClock(t)
+
+	prev := connectDB
+	t.Cleanup(func() { connectDB = prev })
+
+	connectDB = func() error { return errPermanentConnect }
+
+	if err := connectWithRetry(12); !errors.Is(err, errPermanentConnect) {
+		t.Fatalf("err = %v, want errPermanentConnect", err)
+	}
+	if len(fake.sleeps) != 0 {
+		t.Fatalf("slept %v after a permanent error", fake.sleeps)
+	}
+}
+
+func TestClassifyConnectError(t *testing.T) {
+	_, badDSN := pq.NewConnector("postgres://%zz")
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"auth", &pq.Error{Code: "28P01"}, true},
+		{"no database", &pq.Error{Code: "3D000"}, true},
+		{"invalid dsn", fmt.Errorf("%w: %w", errInvalidDSN, badDSN), true},
+		{"no such host", &net.DNSError{Err: "no such host", Name: "haproxy", IsNotFound: true}, false},
+		{"refused", errors.New("dial tcp: connection refused"), false},
+	}
+	for _, tt := range tests {
+		if _, perm := classifyConnectError(tt.err); perm != tt.permanent {
+			t.Errorf("%s: permanent = %v, want %v", tt.name, perm, tt.permanent)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// startTime — момент запуска процесса: uptime на дашборде и отсчёт HEALTH_GRACE_PERIOD
+var startTime = time.Now()
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>ms_app dashboard</title>
+    <meta http-equiv="refresh" content="5">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .info { background: #f5f5f5; padding: 20px; border-radius: 5px; margin-bottom: 20px; }
+        .degraded { background: #dc3545; color: white; padding: 15px 20px; border-radius: 5px; margin-bottom: 20px; font-weight: bold; }
+        table { border-collapse: collapse; }
+        th, td { border: 1px solid #ddd; padding: 6px 12px; text-align: right; }
+        th:first-child, td:first-child { text-align: left; }
+    </style>
+</head>
+<body>
+    {{if .Degraded}}<div class="degraded">⚠️ Degraded mode: the database is unavailable</div>{{end}}
+    <h1>📊 {{.Hostname}}</h1>
+    <div class="info">
+        <p><strong>Version:</strong> {{.Version}}</p>
+        <p><strong>Uptime:</strong> {{.Uptime}}</p>
+        <p><strong>Ready:</strong> {{.Ready}} · <strong>Maintenance:</strong> {{.Maintenance}} · <strong>In-flight requests:</strong> {{.InFlight}}</p>
+    </div>
+    <h3>Connection pools</h3>
+    <table>
+        <tr><th>Pool</th><th>Open</th><th>In use</th><th>Idle</th><th>Max open</th><th>Wait count</th><th>Wait time</th></tr>
+        {{range .Pools}}
+        <tr><td>{{.Name}}</td><td>{{.Stats.OpenConnections}}</td><td>{{.Stats.InUse}}</td><td>{{.Stats.Idle}}</td><td>{{.Stats.MaxOpenConnections}}</td><td>{{.Stats.WaitCount}}</td><td>{{.Stats.WaitDuration}}</td></tr>
+        {{else}}
+        <tr><td colspan="7">No database pools</td></tr>
+        {{end}}
+    </table>
+    <h3>Requests by db_role</h3>
+    <table>
+        <tr><th>Role</th><th>Requests</th><th>DB queries</th><th>DB time</th></tr>
+        {{range .Roles}}
+        <tr><td>{{.Role}}</td><td>{{.Requests}}</td><td>{{.Queries}}</td><td>{{.DBTime}}</td></tr>
+        {{end}}
+    </table>
+    <p><small>Refreshes every 5 seconds · generated {{.Now}}</small></p>
+</body>
+</html>
+`))
+
+type dashboardPool struct {
+	Name  string
+	Stats sql.DBStats
+}
+
+type dashboardRole struct {
+	Role     string
+	Requests int64
+	Queries  int64
+	DBTime   time.Duration
+}
+
+// dashboardHandler — /dashboard: живая сводка для небольших инсталляций без
+// Prometheus/Grafana. Числа те же, что и в /metrics.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		writeHead(w, http.StatusOK, "text/html; charset=utf-8")
+		return
+	}
+
+	hostname, _ := os.Hostname()
+
+	var pools []dashboardPool
+	for _, p := range namedPools() {
+		pools = append(pools, dashboardPool{Name: p.name, Stats: p.db.Stats()})
+	}
+
+	var roles []dashboardRole
+	for _, role := range dbRoles {
+		c := roleMetrics[role]
+		roles = append(roles, dashboardRole{
+			Role:     role,
+			Requests: c.requests.Load(),
+			Queries:  c.queries.Load(),
+			DBTime:   time.Duration(c.dbNanos.Load()).Round(time.Millisecond),
+		})
+	}
+
+	data := map[string]interface{}{
+		"Hostname":    hostname,
+		"Version":     version,
+		"Uptime":      time.Since(startTime).Round(time.Second),
+		"Degraded":    degraded.Load(),
+		"Ready":       ready.Load(),
+		"Maintenance": maintenance.Load(),
+		"InFlight":    inFlight.Load(),
+		"Pools":       pools,
+		"Roles":       roles,
+		"Now":         time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render dashboard: %v", err)
+	}
+}
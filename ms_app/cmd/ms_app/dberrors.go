@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errDBBusy — за DB_ACQUIRE_TIMEOUT не удалось получить соединение из пула
+var errDBBusy = errors.New("database busy")
+
+// errPoolSaturated — FAIL_FAST_ON_SATURATION: все соединения пула заняты,
+// запрос отклонён без ожидания
+var errPoolSaturated = errors.New("database pool exhausted")
+
+// failFastOnSaturation (FAIL_FAST_ON_SATURATION) — при занятом пуле сразу
+// отвечать 503, а не ждать соединение до DB_ACQUIRE_TIMEOUT. Проверка по
+// db.Stats() приблизительная: соединение может освободиться сразу после неё.
+var failFastOnSaturation = envBool("FAIL_FAST_ON_SATURATION", false)
+
+// Сколько ждать свободное соединение из пула (всего их 25), отдельно от таймаута
+// самого запроса. 0 — ждать в пределах таймаута запроса.
+var acquireTimeout = envDuration("DB_ACQUIRE_TIMEOUT", 3*time.Second)
+
+// acquireConn берёт соединение из пула. Если пул исчерпан и соединение не
+// освободилось за acquireTimeout, возвращает errDBBusy — так исчерпание пула
+// отличается от медленного запроса.
+// Пока circuit breaker открыт, соединение не выдаётся вовсе (errCircuitOpen).
+// С FAIL_FAST_ON_SATURATION при занятом пуле сразу возвращается errPoolSaturated.
+func acquireConn(ctx context.Context, pool *sql.DB) (*sql.Conn, error) {
+	breaker := breakerFor(pool)
+	// Запросы по выданному соединению и Retry-After учитываются в breaker этого пула
+	if stats := requestStatsFrom(ctx); stats != nil {
+		stats.breaker.Store(breaker)
+	}
+
+	if !breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	if failFastOnSaturation {
+		if st := pool.Stats(); st.MaxOpenConnections > 0 && st.InUse >= st.MaxOpenConnections {
+			return nil, errPoolSaturated
+		}
+	}
+
+	if acquireTimeout <= 0 {
+		conn, err := pool.Conn(ctx)
+		if err != nil {
+			breaker.record(ctx, err)
+		}
+		return conn, err
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, acquireTimeout)
+	defer cancel()
+
+	conn, err := pool.Conn(acquireCtx)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, errDBBusy
+	}
+	if err != nil {
+		breaker.record(ctx, err)
+	}
+	return conn, err
+}
+
+// writeDBError логирует ошибку работы с БД и отвечает клиенту
+func writeDBError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logDBError(r.Context(), message, err)
+
+	status, code, msg := dbErrorReply(err)
+	switch code {
+	case errCodeCircuitOpen:
+		var breaker *circuitBreaker
+		if stats := requestStatsFrom(r.Context()); stats != nil {
+			breaker = stats.breaker.Load()
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(breaker.retryAfterSeconds()))
+
+	case errCodeQueryTimeout:
+		timeout := "unknown"
+		if stats := requestStatsFrom(r.Context()); stats != nil && stats.queryTimeout.Load() > 0 {
+			timeout = time.Duration(stats.queryTimeout.Load()).String()
+		}
+		log.Printf("⏱️  Query timed out on %s %s (request_id=%s, configured timeout %s)",
+			r.Method, r.URL.Path, requestID(r.Context()), timeout)
+
+	case errCodeInitializing:
+		log.Printf("🚧 %s %s hit a missing table — schema not created yet, check createTable/migrations in the startup log",
+			r.Method, r.URL.Path)
+		w.Header().Set("Retry-After", "5")
+
+	case errCodeDBBusy:
+		if errors.Is(err, errPoolSaturated) {
+			w.Header().Set("Retry-After", "1")
+		}
+
+	default:
+		msg = fmt.Sprintf("%s: %v", message, err)
+	}
+
+	writeError(w, status, code, msg)
+}
+
+// dbErrorReply — статус, код и сообщение ответа на ошибку БД. Для ошибок,
+// которые не распознаны, — 500 db_query_failed с пустым сообщением: его
+// подставляет вызывающий.
+func dbErrorReply(err error) (status int, code, message string) {
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return http.StatusServiceUnavailable, errCodeCircuitOpen, "Database temporarily unavailable, try again later"
+	case isQueryTimeout(err):
+		return http.StatusGatewayTimeout, errCodeQueryTimeout, "query timed out"
+	case isUndefinedTable(err):
+		return http.StatusServiceUnavailable, errCodeInitializing, "service initializing"
+	case errors.Is(err, errPoolSaturated):
+		return http.StatusServiceUnavailable, errCodeDBBusy, "database pool exhausted"
+	case errors.Is(err, errDBBusy):
+		return http.StatusServiceUnavailable, errCodeDBBusy, "database busy"
+	}
+	return http.StatusInternalServerError, errCodeDBQueryFailed, ""
+}
+
+// isQueryTimeout — истёк дедлайн контекста или PostgreSQL отменил запрос
+// (57014 query_canceled, в том числе по statement_timeout)
+func isQueryTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// isUndefinedTable — таблицы ещё нет (42P01): запрос пришёл раньше, чем createTable
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
+
+// isSerializationFailure — SERIALIZABLE-транзакция отменена из-за конфликта (40001)
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "40001"
+}
+
+// errPermanentConnect — все настроенные варианты подключения отказали по
+// причине, которую повтор не исправит (пароль, имя базы, неразборчивый DSN)
+var errPermanentConnect = errors.New("permanent connection error")
+
+// errInvalidDSN — строку подключения не удалось разобрать (openPool)
+var errInvalidDSN = errors.New("invalid connection string")
+
+// classifyConnectError определяет, имеет ли смысл повторять подключение.
+// reason — короткое описание для лога.
+func classifyConnectError(err error) (reason string, permanent bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "28P01":
+			return "authentication failed", true
+		case "28000":
+			return "authorization rejected (pg_hba.conf)", true
+		case "3D000":
+			return "database does not exist", true
+		}
+		return "server error " + string(pqErr.Code), false
+	}
+
+	if errors.Is(err, errInvalidDSN) {
+		return "invalid connection string", true
+	}
+
+	// NXDOMAIN не считаем окончательным: в docker compose имя сервиса (haproxy)
+	// появляется в DNS только после старта его контейнера
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "host not found", false
+	}
+
+	return "transient", false
+}
+
+// uniqueViolation возвращает ошибку PostgreSQL, если это нарушение уникальности (23505)
+func uniqueViolation(err error) (*pq.Error, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr, true
+	}
+	return nil, false
+}
+
+// Detail у 23505 выглядит как: Key (email)=(foo@example.com) already exists.
+var uniqueDetailRe = regexp.MustCompile(`^Key \((.+)\)=\((.*)\) already exists\.?$`)
+
+// writeDuplicateError отвечает 409 с именем ограничения, полем и значением-дубликатом
+func writeDuplicateError(w http.ResponseWriter, pqErr *pq.Error) {
+	details := map[string]string{"constraint": pqErr.Constraint}
+	if m := uniqueDetailRe.FindStringSubmatch(pqErr.Detail); m != nil {
+		details["field"] = m[1]
+		details["value"] = m[2]
+	}
+
+	writeJSON(w, http.StatusConflict, ErrorResponse{
+		Error:   "Email already exists",
+		Code:    errCodeDuplicateEmail,
+		Details: details,
+	})
+}
+
+// dbErrorEntry — запись лога об ошибке БД. Для *pq.Error поля PostgreSQL
+// (SQLSTATE и пр.) пишутся отдельно, чтобы по ним можно было строить алерты,
+// например на 53300 too_many_connections.
+type dbErrorEntry struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Msg        string `json:"msg"`
+	RequestID  string `json:"request_id,omitempty"`
+	Error      string `json:"error"`
+	SQLState   string `json:"sqlstate,omitempty"`
+	Condition  string `json:"condition,omitempty"`
+	PgMessage  string `json:"pg_message,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	Table      string `json:"table,omitempty"`
+}
+
+func logDBError(ctx context.Context, msg string, err error) {
+	entry := dbErrorEntry{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Level:     "error",
+		Msg:       msg,
+		RequestID: requestID(ctx),
+		Error:     err.Error(),
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		entry.SQLState = string(pqErr.Code)
+		entry.Condition = pqErr.Code.Name()
+		entry.PgMessage = pqErr.Message
+		entry.Detail = pqErr.Detail
+		entry.Constraint = pqErr.Constraint
+		entry.Table = pqErr.Table
+	}
+
+	line, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		log.Printf("%s: %v", msg, err)
+		return
+	}
+	jsonLog.Println(string(line))
+}
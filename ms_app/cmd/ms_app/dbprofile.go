@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dbProfile — шаблон подключения: хост и порт по умолчанию для узла стенда
+type dbProfile struct {
+	host string
+	port string
+}
+
+// dbProfiles — встроенные варианты подключения из docker-compose
+var dbProfiles = map[string]dbProfile{
+	"local":         {"localhost", "5433"},       // локально, HAProxy из compose проброшен на хост
+	"haproxy":       {"haproxy", "5433"},         // через HAProxy
+	"direct-master": {"postgres-master", "5432"}, // напрямую к мастеру
+	"direct-slave1": {"postgres-slave1", "5432"}, // напрямую к слейву 1
+	"direct-slave2": {"postgres-slave2", "5432"}, // напрямую к слейву 2
+}
+
+// dbProfileName (DB_PROFILE) — выбранный профиль; пусто — профиль не используется
+var dbProfileName = getenv("DB_PROFILE")
+
+// profileDSN собирает DSN профиля. DB_HOST/DB_PORT переопределяют адрес профиля,
+// DB_USER, DB_PASSWORD, DB_NAME и DB_SSLMODE — учётные данные и параметры.
+func profileDSN(name string) (string, bool) {
+	profile, ok := dbProfiles[name]
+	if !ok {
+		return "", false
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(envOrDefault("DB_USER", "user"), envOrDefault("DB_PASSWORD", "password")),
+		Host:     envOrDefault("DB_HOST", profile.host) + ":" + envOrDefault("DB_PORT", profile.port),
+		Path:     "/" + envOrDefault("DB_NAME", "testdb"),
+		RawQuery: url.Values{"sslmode": {envOrDefault("DB_SSLMODE", "disable")}}.Encode(),
+	}
+	return u.String(), true
+}
+
+// checkDBProfile проверяет DB_PROFILE при старте и пишет выбранный профиль в лог
+func checkDBProfile() {
+	if dbProfileName == "" {
+		return
+	}
+
+	dsn, ok := profileDSN(dbProfileName)
+	if !ok {
+		names := make([]string, 0, len(dbProfiles))
+		for name := range dbProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Fatalf("💥 Unknown DB_PROFILE %q, expected one of: %s", dbProfileName, strings.Join(names, ", "))
+	}
+
+	log.Printf("🗂️  Using DB profile %q: %s", dbProfileName, maskPassword(dsn))
+}
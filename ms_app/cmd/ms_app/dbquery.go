@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// queryer — общее для *sql.DB, *sql.Conn и *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Обёртки над запросами учитывают время в БД для access log и сообщают
+// результат circuit breaker'у пула (queryBreaker). Для dbQuery учитывается время до получения
+// первых строк, без итерации.
+
+func dbQuery(ctx context.Context, q queryer, query string, args ...interface{}) (*sql.Rows, error) {
+	defer trackDBTime(ctx, time.Now())
+	rows, err := q.QueryContext(ctx, tagQuery(ctx, query), args...)
+	queryBreaker(ctx, q).record(ctx, err)
+	return rows, err
+}
+
+func dbQueryRow(ctx context.Context, q queryer, query string, args ...interface{}) *sql.Row {
+	defer trackDBTime(ctx, time.Now())
+	row := q.QueryRowContext(ctx, tagQuery(ctx, query), args...)
+	queryBreaker(ctx, q).record(ctx, row.Err())
+	return row
+}
+
+func dbExec(ctx context.Context, q queryer, query string, args ...interface{}) (sql.Result, error) {
+	defer trackDBTime(ctx, time.Now())
+	res, err := q.ExecContext(ctx, tagQuery(ctx, query), args...)
+	queryBreaker(ctx, q).record(ctx, err)
+	return res, err
+}
+
+// queryTags (DB_QUERY_TAGS) — добавлять к запросам комментарий /* endpoint=... */.
+// Тег виден в pg_stat_activity (какой эндпоинт держит соединение или висит
+// на блокировке) и в логах PostgreSQL (log_min_duration_statement). Разбивки
+// по эндпоинтам в pg_stat_statements он не даёт: комментарии не входят в
+// ключ группировки, и у строки остаётся текст, пришедший первым. По умолчанию
+// выключено.
+var queryTags = envBool("DB_QUERY_TAGS", false)
+
+var endpointNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// withEndpoint кладёт имя эндпоинта в контекст запроса для tagQuery
+func withEndpoint(name string, next http.HandlerFunc) http.Handler {
+	if name == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), endpointKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tagQuery добавляет в начало запроса комментарий с именем эндпоинта.
+// Имя проверяется, чтобы "*/" не мог закрыть комментарий.
+func tagQuery(ctx context.Context, query string) string {
+	if !queryTags {
+		return query
+	}
+
+	name, _ := ctx.Value(endpointKey).(string)
+	if name == "" || !endpointNameRe.MatchString(name) {
+		return query
+	}
+	return "/* endpoint=" + name + " */ " + query
+}
+
+func trackDBTime(ctx context.Context, start time.Time) {
+	if stats := requestStatsFrom(ctx); stats != nil {
+		stats.dbNanos.Add(int64(time.Since(start)))
+		stats.dbQueries.Add(1)
+	}
+}
+
+// txBeginner — *sql.DB или *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// withTx выполняет fn в транзакции: commit, если fn вернула nil, иначе rollback.
+// При панике внутри fn транзакция откатывается, а паника пробрасывается дальше.
+func withTx(ctx context.Context, b txBeginner, fn func(tx *sql.Tx) error) error {
+	return withTxOptions(ctx, b, nil, fn)
+}
+
+func withTxOptions(ctx context.Context, b txBeginner, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := b.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Transaction rollback failed: %v", rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// serializableRetries (SERIALIZABLE_MAX_RETRIES) — сколько раз повторять
+// SERIALIZABLE-транзакцию после ошибки сериализации
+var serializableRetries = envInt("SERIALIZABLE_MAX_RETRIES", 3)
+
+// withSerializableTx выполняет fn в транзакции SERIALIZABLE и повторяет её
+// целиком, если PostgreSQL отменил её из-за конфликта с параллельной (40001).
+// Для проверок вида «посчитать, затем вставить», которые на READ COMMITTED
+// пропускают гонки между инстансами. fn должна быть безопасна для повтора.
+func withSerializableTx(ctx context.Context, b txBeginner, fn func(tx *sql.Tx) error) error {
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+
+	for attempt := 0; ; attempt++ {
+		err := withTxOptions(ctx, b, opts, fn)
+		if !isSerializationFailure(err) || attempt >= serializableRetries || ctx.Err() != nil {
+			return err
+		}
+
+		debugf("Serialization failure, retrying transaction (attempt %d/%d)", attempt+1, serializableRetries)
+		// Небольшая случайная пауза, чтобы конкурирующие транзакции разошлись
+		clock.Sleep(time.Duration(attempt+1)*10*time.Millisecond + time.Duration(rand.Int63n(int64(10*time.Millisecond))))
+	}
+}
+
+// withPinnedTx берёт одно соединение из пула записи и выполняет fn в транзакции
+// на нём: чтение и запись внутри fn видят один и тот же узел, даже если за
+// пулом стоит HAProxy. Ошибки получения соединения (errDBBusy, errCircuitOpen)
+// возвращаются как есть — их разбирает writeDBError.
+func withPinnedTx(ctx context.Context, pool *sql.DB, fn func(tx *sql.Tx) error) error {
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return withTx(ctx, conn, fn)
+}
+
+// withUserLimitTx — транзакция для записей, которые проверяют MAX_USERS
+// (checkUserLimit): при заданном лимите SERIALIZABLE с повтором, иначе
+// параллельные пакеты с разных инстансов вместе превысят лимит. Без лимита —
+// обычная транзакция. fn должна быть безопасна для повтора.
+func withUserLimitTx(ctx context.Context, b txBeginner, fn func(tx *sql.Tx) error) error {
+	if maxUsers > 0 {
+		return withSerializableTx(ctx, b, fn)
+	}
+	return withTx(ctx, b, fn)
+}
+
+// withPinnedUserLimitTx — withPinnedTx с транзакцией withUserLimitTx
+func withPinnedUserLimitTx(ctx context.Context, pool *sql.DB, fn func(tx *sql.Tx) error) error {
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return withUserLimitTx(ctx, conn, fn)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatencySamples = 10
+	maxLatencySamples     = 1000
+)
+
+type LatencyResponse struct {
+	Samples int     `json:"samples"`
+	MinMs   float64 `json:"min_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+}
+
+// latencyHandler замеряет время SELECT 1 до БД (через HAProxy или напрямую).
+// Меряется текущий пул записи: после переключения на standby — он.
+func latencyHandler(w http.ResponseWriter, r *http.Request) {
+	pool := activeDB()
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	n := defaultLatencySamples
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxLatencySamples {
+			writeError(w, http.StatusBadRequest, errCodeValidation,
+				fmt.Sprintf("n must be an integer between 1 and %d", maxLatencySamples))
+			return
+		}
+		n = v
+	}
+
+	ctx, cancel := queryContext(r, 30*time.Second)
+	defer cancel()
+
+	samples := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		var one int
+		if err := dbQueryRow(ctx, pool, "SELECT 1").Scan(&one); err != nil {
+			writeDBError(w, r, err, "Database query failed")
+			return
+		}
+		samples = append(samples, time.Since(start))
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+
+	// p95 по методу ближайшего ранга
+	p95 := samples[(len(samples)*95+99)/100-1]
+
+	writeJSON(w, http.StatusOK, LatencyResponse{
+		Samples: n,
+		MinMs:   durationMs(samples[0]),
+		AvgMs:   durationMs(total / time.Duration(n)),
+		MaxMs:   durationMs(samples[n-1]),
+		P95Ms:   durationMs(p95),
+	})
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// BackendStatus — результат проверки одного DSN
+type BackendStatus struct {
+	Source    string  `json:"source"`
+	DSN       string  `json:"dsn"`
+	Status    string  `json:"status"`
+	Role      string  `json:"role,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// backendsHandler подключается к каждому настроенному DSN (кандидаты initDB
+// и DB_READ_URLS) и сообщает статус, роль и задержку — пул HAProxy глазами приложения
+func backendsHandler(w http.ResponseWriter, r *http.Request) {
+	type target struct{ source, dsn string }
+
+	var targets []target
+	for i, c := range connectionCandidates() {
+		if c.dsn != "" {
+			targets = append(targets, target{fmt.Sprintf("candidate-%d-%s", i+1, c.route), c.dsn})
+		}
+	}
+	for i, dsn := range strings.Split(getenv("DB_READ_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			targets = append(targets, target{fmt.Sprintf("read-%d", i+1), dsn})
+		}
+	}
+
+	ctx, cancel := queryContext(r, 5*time.Second)
+	defer cancel()
+
+	results := make([]BackendStatus, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			results[i] = checkBackend(ctx, t.source, t.dsn)
+		}(i, t)
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func checkBackend(ctx context.Context, source, dsn string) BackendStatus {
+	status := BackendStatus{Source: source, DSN: maskPassword(dsn), Status: "ok"}
+
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		status.Status, status.Error = "error", err.Error()
+		return status
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	err = conn.PingContext(ctx)
+	status.LatencyMs = durationMs(time.Since(start))
+	if err != nil {
+		status.Status, status.Error = "error", err.Error()
+		return status
+	}
+
+	var inRecovery bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		status.Role = "unknown"
+	} else {
+		status.Role = dbRole(inRecovery)
+	}
+
+	return status
+}
+
+// TableSizeResponse — размер таблицы users для планирования ёмкости
+type TableSizeResponse struct {
+	Table      string `json:"table"`
+	TotalBytes int64  `json:"total_bytes"` // с индексами и TOAST
+	TotalHuman string `json:"total_human"`
+	// RowEstimate — reltuples из pg_class (обновляется VACUUM/ANALYZE);
+	// nil, если таблицу ещё ни разу не анализировали
+	RowEstimate *int64 `json:"row_estimate"`
+}
+
+// tableSizeHandler — /diag/table-size: размер users и оценка числа строк без
+// COUNT(*) по всей таблице
+func tableSizeHandler(w http.ResponseWriter, r *http.Request) {
+	pool := activeDB()
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	resp := TableSizeResponse{Table: "users"}
+	var reltuples float64
+	err := dbQueryRow(ctx, pool,
+		`SELECT pg_total_relation_size(c.oid), pg_size_pretty(pg_total_relation_size(c.oid)), c.reltuples
+		FROM pg_class c WHERE c.oid = 'users'::regclass`,
+	).Scan(&resp.TotalBytes, &resp.TotalHuman, &reltuples)
+	if err != nil {
+		writeDBError(w, r, err, "Table size query failed")
+		return
+	}
+
+	// До первого ANALYZE reltuples = -1 (PostgreSQL 14+) или 0
+	if reltuples >= 0 {
+		n := int64(reltuples)
+		resp.RowEstimate = &n
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ConnectionAttempt — результат одной попытки initDB подключиться к кандидату
+type ConnectionAttempt struct {
+	Target    string    `json:"target"`
+	DSN       string    `json:"dsn,omitempty"`
+	Time      *jsonTime `json:"time,omitempty"`    // nil у пропущенного кандидата
+	Skipped   bool      `json:"skipped,omitempty"` // DSN кандидата не задан
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+}
+
+// maxConnectionAttempts — сколько последних попыток хранить
+const maxConnectionAttempts = 50
+
+var (
+	connectionAttemptsMu sync.Mutex
+	connectionAttempts   []ConnectionAttempt
+)
+
+func recordConnectionAttempt(a ConnectionAttempt) {
+	connectionAttemptsMu.Lock()
+	defer connectionAttemptsMu.Unlock()
+
+	connectionAttempts = append(connectionAttempts, a)
+	if n := len(connectionAttempts); n > maxConnectionAttempts {
+		connectionAttempts = connectionAttempts[n-maxConnectionAttempts:]
+	}
+}
+
+// connectionTargetHandler — /diag/connection-target: куда подключился initDB
+// и какие кандидаты он пропустил или не смог использовать
+func connectionTargetHandler(w http.ResponseWriter, r *http.Request) {
+	connectionAttemptsMu.Lock()
+	// Не nil даже без попыток: writeJSON заменяет nil только на верхнем уровне
+	attempts := make([]ConnectionAttempt, 0, len(connectionAttempts))
+	attempts = append(attempts, connectionAttempts...)
+	connectionAttemptsMu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"route_target": routeTarget,
+		"attempts":     attempts,
+	})
+}
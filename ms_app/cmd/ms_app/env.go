@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// getenv читает переменную окружения. Если она не задана, но задана <KEY>_FILE,
+// значение берётся из этого файла (секреты, смонтированные оркестратором),
+// без завершающих переводов строки. Файл читается при первом обращении и
+// дальше берётся из кэша до SIGHUP (reloadFileEnv): getenv вызывается и на
+// каждое соединение, и на каждый запрос.
+func getenv(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return ""
+	}
+
+	fileEnvMu.RLock()
+	v, ok := fileEnv[key]
+	fileEnvMu.RUnlock()
+	if ok {
+		return v
+	}
+
+	v = readEnvFile(key, path)
+	fileEnvMu.Lock()
+	fileEnv[key] = v
+	fileEnvMu.Unlock()
+	return v
+}
+
+// fileEnv — прочитанные значения <KEY>_FILE; "" — файл не прочитался
+var (
+	fileEnvMu sync.RWMutex
+	fileEnv   = map[string]string{}
+)
+
+func readEnvFile(key, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("⚠️  Could not read %s_FILE: %v", key, err)
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// reloadFileEnv перечитывает файлы уже запрошенных <KEY>_FILE (на SIGHUP)
+func reloadFileEnv() {
+	fileEnvMu.Lock()
+	defer fileEnvMu.Unlock()
+
+	for key := range fileEnv {
+		fileEnv[key] = readEnvFile(key, os.Getenv(key+"_FILE"))
+	}
+}
+
+// envOrDefault возвращает значение переменной или def, если она не задана
+func envOrDefault(key, def string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envDuration читает длительность в формате time.ParseDuration ("30s", "5m")
+func envDuration(key string, def time.Duration) time.Duration {
+	raw := getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("⚠️  Invalid value %q for %s, using default %v", raw, key, def)
+		return def
+	}
+
+	return d
+}
+
+// envInt читает неотрицательное целое
+func envInt(key string, def int) int {
+	raw := getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		log.Printf("⚠️  Invalid value %q for %s, using default %d", raw, key, def)
+		return def
+	}
+
+	return v
+}
+
+// envBool читает флаг (true/false, 1/0)
+func envBool(key string, def bool) bool {
+	raw := getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("⚠️  Invalid value %q for %s, using default %v", raw, key, def)
+		return def
+	}
+
+	return v
+}
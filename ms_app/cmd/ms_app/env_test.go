@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetenvCachesFileUntilReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_FILE", path)
+	t.Cleanup(func() {
+		fileEnvMu.Lock()
+		delete(fileEnv, "TEST_SECRET")
+		fileEnvMu.Unlock()
+	})
+
+	if got := getenv("TEST_SECRET"); got != "first" {
+		t.Fatalf("getenv = %q, want first", got)
+	}
+
+	if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := getenv("TEST_SECRET"); got != "first" {
+		t.Fatalf("getenv before reload = %q, want cached first", got)
+	}
+
+	reloadFileEnv()
+	if got := getenv("TEST_SECRET"); got != "second" {
+		t.Fatalf("getenv after reload = %q, want second", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportTimeout (EXPORT_TIMEOUT) — выгрузка всей таблицы может идти дольше
+// обычного запроса
+var exportTimeout = newDurationSetting("EXPORT_TIMEOUT", 5*time.Minute)
+
+// exportFlushRows — через сколько строк сбрасывать буфер клиенту
+const exportFlushRows = 500
+
+// exportPartial (EXPORT_ON_ERROR=partial) — что делать, если чтение строк
+// оборвалось посреди выгрузки, когда 200 и заголовки уже отправлены:
+//   - abort (по умолчанию): рвём соединение без завершающего чанка, и клиент
+//     (и Nginx) видят незавершённую передачу, а не «успешный» обрезанный файл;
+//   - partial: дописываем уже прочитанные строки, корректно завершаем ответ
+//     и сообщаем об ошибке в трейлере X-Export-Status.
+//
+// Трейлеры X-Export-Status (complete/error) и X-Export-Rows отправляются всегда.
+// Nginx трейлеры upstream клиенту не передаёт, за ним надёжен только режим abort.
+var exportPartial = envOrDefault("EXPORT_ON_ERROR", "abort") == "partial"
+
+// exportUsersHandler — GET /users/export: потоковая выгрузка пользователей в CSV.
+// Контекст запроса отменяется, когда клиент или прокси (proxy_read_timeout,
+// timeout server) закрывает соединение: тогда драйвер прерывает запрос,
+// цикл останавливается, а rows.Close сразу возвращает соединение в пул.
+func exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		writeHead(w, http.StatusOK, "text/csv; charset=utf-8")
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	pool := readDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	ctx, cancel := queryContext(r, exportTimeout.Get())
+	defer cancel()
+
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		writeDBError(w, r, err, "Export query failed")
+		return
+	}
+	defer conn.Close()
+
+	rows, err := dbQuery(ctx, conn, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		writeDBError(w, r, err, "Export query failed")
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+	w.Header().Set("Trailer", "X-Export-Status, X-Export-Rows")
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "name", "email", "created_at", "updated_at"})
+
+	count := 0
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			// При отмене database/sql закрывает rows из своей горутины, и Scan
+			// может вернуть "Rows are closed" раньше, чем Next вернёт false
+			if r.Context().Err() != nil {
+				log.Printf("🔌 Export cancelled after %d rows (request_id=%s)", count, requestID(r.Context()))
+				return
+			}
+			failExport(w, r, cw, count, err)
+			return
+		}
+
+		cw.Write([]string{
+			strconv.Itoa(int(user.ID)),
+			user.Name,
+			user.Email,
+			user.CreatedAt.Format(time.RFC3339),
+			user.UpdatedAt.Format(time.RFC3339),
+		})
+		count++
+
+		if count%exportFlushRows == 0 {
+			cw.Flush()
+			if cw.Error() != nil || ctx.Err() != nil {
+				// Клиент ушёл — дальше читать строки бессмысленно
+				log.Printf("🔌 Export cancelled after %d rows (request_id=%s)", count, requestID(r.Context()))
+				return
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("🔌 Export cancelled after %d rows (request_id=%s)", count, requestID(r.Context()))
+			return
+		}
+		failExport(w, r, cw, count, err)
+		return
+	}
+
+	cw.Flush()
+	w.Header().Set("X-Export-Status", "complete")
+	w.Header().Set("X-Export-Rows", strconv.Itoa(count))
+}
+
+// failExport завершает выгрузку, оборвавшуюся на ошибке БД: статус 200 уже
+// отправлен, поэтому поведение задаёт EXPORT_ON_ERROR
+func failExport(w http.ResponseWriter, r *http.Request, cw *csv.Writer, count int, err error) {
+	if !exportPartial {
+		log.Printf("⚠️  Export aborted after %d rows (request_id=%s): %v", count, requestID(r.Context()), err)
+		panic(http.ErrAbortHandler)
+	}
+
+	log.Printf("⚠️  Export ended early with %d rows (request_id=%s, partial mode): %v", count, requestID(r.Context()), err)
+	cw.Flush()
+	w.Header().Set("X-Export-Status", "error")
+	w.Header().Set("X-Export-Rows", strconv.Itoa(count))
+}
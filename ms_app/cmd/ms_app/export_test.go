@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportStopsWhenClientCancels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Бесконечная выгрузка; клиент уходит после первых двух порций
+	const cancelAt = 2 * exportFlushRows
+	rows := userRows(-1, -1, nil)
+	next := rows.next
+	rows.next = func(i int, dest []driver.Value) error {
+		if i == cancelAt {
+			cancel()
+		}
+		return next(i, dest)
+	}
+	pool := useFakeDB(t, func(string) (driver.Rows, error) { return rows, nil })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/users/export", nil).WithContext(ctx)
+		exportUsersHandler(httptest.NewRecorder(), req)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export did not stop after the request context was cancelled")
+	}
+
+	select {
+	case <-rows.closed:
+	default:
+		t.Fatal("rows were not closed")
+	}
+
+	// После отмены дочитывается не больше одной порции до проверки ctx.Err()
+	if n := rows.reads.Load(); n > cancelAt+exportFlushRows+1 {
+		t.Fatalf("read %d rows after cancelling at %d", n, cancelAt)
+	}
+
+	if inUse := pool.Stats().InUse; inUse != 0 {
+		t.Fatalf("%d connections still in use", inUse)
+	}
+}
+
+// Ошибка чтения после первой порции: 200 и заголовки уже у клиента
+const exportFailAt = exportFlushRows + 100
+
+var errExportRows = errors.New("connection reset by peer")
+
+func TestExportAbortsOnRowsError(t *testing.T) {
+	prev := exportPartial
+	exportPartial = false
+	t.Cleanup(func() { exportPartial = prev })
+
+	useFakeDB(t, func(string) (driver.Rows, error) {
+		return userRows(-1, exportFailAt, errExportRows), nil
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(exportUsersHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	// Без завершающего чанка клиент видит оборванную передачу, а не полный файл
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("reading body: err = %v, want unexpected EOF", err)
+	}
+	if status := resp.Trailer.Get("X-Export-Status"); status != "" {
+		t.Fatalf("X-Export-Status = %q, want no trailer", status)
+	}
+}
+
+func TestExportPartialOnRowsError(t *testing.T) {
+	prev := exportPartial
+	exportPartial = true
+	t.Cleanup(func() { exportPartial = prev })
+
+	useFakeDB(t, func(string) (driver.Rows, error) {
+		return userRows(-1, exportFailAt, errExportRows), nil
+	})
+
+	rec := httptest.NewRecorder()
+	exportUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/users/export", nil))
+	resp := rec.Result()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if status := resp.Trailer.Get("X-Export-Status"); status != "error" {
+		t.Fatalf("X-Export-Status = %q, want error", status)
+	}
+	if n := resp.Trailer.Get("X-Export-Rows"); n != strconv.Itoa(exportFailAt) {
+		t.Fatalf("X-Export-Rows = %q, want %d", n, exportFailAt)
+	}
+
+	// Строка заголовка CSV плюс все строки, прочитанные до ошибки
+	body, _ := io.ReadAll(resp.Body)
+	if lines := strings.Count(string(body), "\n"); lines != exportFailAt+1 {
+		t.Fatalf("body has %d lines, want %d", lines, exportFailAt+1)
+	}
+}
+
+func TestExportCompleteTrailer(t *testing.T) {
+	useFakeDB(t, func(string) (driver.Rows, error) { return userRows(3, -1, nil), nil })
+
+	rec := httptest.NewRecorder()
+	exportUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/users/export", nil))
+	resp := rec.Result()
+
+	if status := resp.Trailer.Get("X-Export-Status"); status != "complete" {
+		t.Fatalf("X-Export-Status = %q, want complete", status)
+	}
+	if n := resp.Trailer.Get("X-Export-Rows"); n != "3" {
+		t.Fatalf("X-Export-Rows = %q, want 3", n)
+	}
+}
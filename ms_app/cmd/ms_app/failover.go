@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Резервное подключение на случай, когда недоступен сам DATABASE_URL
+// (например, упал HAProxy). После FAILOVER_THRESHOLD неудачных проверок подряд
+// запросы переключаются на STANDBY_DATABASE_URL, а когда основной снова отвечает —
+// возвращаются на него.
+var (
+	standbyDB  *sql.DB
+	failedOver atomic.Bool
+)
+
+// activeDB — основной пул или резервный, если произошло переключение
+func activeDB() *sql.DB {
+	if failedOver.Load() {
+		return standbyDB
+	}
+	return db
+}
+
+func initStandby() {
+	dsn := getenv("STANDBY_DATABASE_URL")
+	if dsn == "" {
+		return
+	}
+
+	pool, err := openPool(dsn)
+	if err != nil {
+		log.Printf("⚠️  Invalid STANDBY_DATABASE_URL: %v", err)
+		return
+	}
+	configurePool(pool)
+	standbyDB = pool
+
+	log.Printf("🛟 Standby database configured: %s", maskPassword(dsn))
+	go monitorFailover()
+}
+
+func monitorFailover() {
+	threshold := envInt("FAILOVER_THRESHOLD", 3)
+	ticker := time.NewTicker(envDuration("FAILOVER_CHECK_INTERVAL", 5*time.Second))
+	defer ticker.Stop()
+
+	failures := 0
+	for range ticker.C {
+		err := pingPool(db)
+		if err == nil {
+			failures = 0
+			if failedOver.Swap(false) {
+				log.Println("🔁 Primary database recovered, switched back from standby")
+			}
+			continue
+		}
+
+		failures++
+		if failures < threshold || failedOver.Load() {
+			continue
+		}
+
+		if standbyErr := pingPool(standbyDB); standbyErr != nil {
+			log.Printf("❌ Primary database is down (%v), standby is unavailable too: %v", err, standbyErr)
+			continue
+		}
+
+		failedOver.Store(true)
+		log.Printf("🛟 Primary database failed %d checks in a row (%v), switched to standby", failures, err)
+	}
+}
+
+func pingPool(pool *sql.DB) error {
+	if pool == nil {
+		return errors.New("database not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return pool.PingContext(ctx)
+}
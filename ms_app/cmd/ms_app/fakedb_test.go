@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDB — драйвер database/sql без сервера: ответ на запрос выбирает
+// query по тексту SQL. Хватает для обработчиков, которые только читают.
+type fakeDB struct {
+	query func(query string) (driver.Rows, error)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakedb: use sql.OpenDB")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakedb: transactions are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query)
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.query(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// fakeRows отдаёт строки из next до io.EOF и запоминает, сколько раз его
+// читали и закрыли ли его
+type fakeRows struct {
+	cols   []string
+	next   func(i int, dest []driver.Value) error
+	reads  atomic.Int64
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeRows(cols []string, next func(i int, dest []driver.Value) error) *fakeRows {
+	return &fakeRows{cols: cols, next: next, closed: make(chan struct{})}
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+
+func (r *fakeRows) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	return r.next(int(r.reads.Add(1)-1), dest)
+}
+
+// userRows — n пользователей (n < 0 — бесконечно); с failAt >= 0 чтение
+// строки failAt возвращает err
+func userRows(n, failAt int, err error) *fakeRows {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return newFakeRows(strings.Split(userColumns, ", "), func(i int, dest []driver.Value) error {
+		if i == failAt {
+			return err
+		}
+		if n >= 0 && i >= n {
+			return io.EOF
+		}
+		dest[0] = int64(i + 1)
+		dest[1] = "user"
+		dest[2] = "user@example.com"
+		dest[3] = created
+		dest[4] = created
+		return nil
+	})
+}
+
+// countRows — результат SELECT COUNT(*)
+func countRows(n int64) *fakeRows {
+	return newFakeRows([]string{"count"}, func(i int, dest []driver.Value) error {
+		if i > 0 {
+			return io.EOF
+		}
+		dest[0] = n
+		return nil
+	})
+}
+
+// useFakeDB подставляет fakeDB основным пулом на время теста
+func useFakeDB(t *testing.T, query func(query string) (driver.Rows, error)) *sql.DB {
+	t.Helper()
+
+	pool := sql.OpenDB(&fakeDB{query: query})
+	prev := db
+	db = pool
+	t.Cleanup(func() {
+		db = prev
+		pool.Close()
+	})
+	return pool
+}
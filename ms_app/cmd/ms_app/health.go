@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ready выставляется после первого успешного createTable
+var ready atomic.Bool
+
+// readinessFile (READINESS_FILE) — файл-флаг готовности для менеджеров процессов,
+// которые следят за файлом, а не за HTTP: создаётся, когда БД подключена и схема
+// готова, удаляется при остановке и в деградированном режиме
+var readinessFile = getenv("READINESS_FILE")
+
+// markReady отмечает инстанс готовым и создаёт READINESS_FILE
+func markReady() {
+	ready.Store(true)
+
+	if readinessFile == "" || degraded.Load() {
+		return
+	}
+	if err := os.WriteFile(readinessFile, nil, 0o644); err != nil {
+		log.Printf("⚠️  Could not create READINESS_FILE %s: %v", readinessFile, err)
+		return
+	}
+	log.Printf("📄 Readiness file created: %s", readinessFile)
+}
+
+// removeReadinessFile удаляет READINESS_FILE, в том числе оставшийся от прошлого запуска
+func removeReadinessFile() {
+	if readinessFile == "" {
+		return
+	}
+	if err := os.Remove(readinessFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("⚠️  Could not remove READINESS_FILE %s: %v", readinessFile, err)
+	}
+}
+
+// retryCreateTable повторяет создание схемы в фоне, пока не получится
+func retryCreateTable() {
+	for {
+		<-clock.After(5 * time.Second)
+
+		if err := createTable(); err != nil {
+			log.Printf("⚠️  Could not create table (retrying): %v", err)
+			continue
+		}
+
+		log.Println("✅ Database table checked/created successfully, instance is ready")
+		markReady()
+		return
+	}
+}
+
+// liveHandler — процесс жив (без обращения к БД)
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// Grace period после старта (HEALTH_GRACE_PERIOD, 0 — выключен): пока пул
+// прогревается, /healthz/ready отвечает одинаково, чтобы HAProxy не дёргал
+// бэкенд туда-обратно. HEALTH_GRACE_MODE=optimistic — 200, unavailable — 503.
+var (
+	healthGracePeriod = envDuration("HEALTH_GRACE_PERIOD", 0)
+	healthGraceReady  = envOrDefault("HEALTH_GRACE_MODE", "optimistic") != "unavailable"
+)
+
+func inGracePeriod() bool {
+	return healthGracePeriod > 0 && clock.Now().Sub(startTime) < healthGracePeriod
+}
+
+// startGracePeriodTimer пишет в лог, когда grace period закончился
+func startGracePeriodTimer() {
+	if healthGracePeriod <= 0 {
+		return
+	}
+
+	remaining := healthGracePeriod - clock.Now().Sub(startTime)
+	if remaining <= 0 {
+		log.Printf("⏳ Health grace period of %v already elapsed during startup", healthGracePeriod)
+		return
+	}
+
+	go func() {
+		<-clock.After(remaining)
+		log.Printf("⏳ Health grace period of %v ended, readiness now reflects real state (ready=%v)",
+			healthGracePeriod, ready.Load())
+	}()
+}
+
+// readyHandler — инстанс готов принимать трафик (схема создана)
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if inGracePeriod() {
+		if healthGraceReady {
+			writeProbe(w, true, "ready (grace period)")
+		} else {
+			writeProbe(w, false, "starting")
+		}
+		return
+	}
+
+	if !ready.Load() {
+		writeProbe(w, false, "not ready")
+		return
+	}
+
+	writeProbe(w, true, "ready")
+}
+
+// readyReadHandler — /healthz/ready/read: схема создана и пул чтения отвечает на ping
+func readyReadHandler(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		writeProbe(w, false, "not ready")
+		return
+	}
+
+	if err := pingPool(readDB(r)); err != nil {
+		writeProbe(w, false, "read pool unavailable")
+		return
+	}
+
+	writeProbe(w, true, "ready")
+}
+
+// readyWriteHandler — /healthz/ready/write: готов к записи, только если пул записи
+// смотрит на primary. Пока HAProxy ведёт write-VIP на узел, который ещё
+// в recovery (идёт promote), записи на этот инстанс слать нельзя.
+func readyWriteHandler(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() || dryRun {
+		writeProbe(w, false, "not ready")
+		return
+	}
+
+	pool := writeDB(r)
+	if pool == nil {
+		writeProbe(w, false, "write pool unavailable")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	var inRecovery bool
+	if err := dbQueryRow(ctx, pool, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		writeProbe(w, false, "write pool unavailable")
+		return
+	}
+	if inRecovery {
+		writeProbe(w, false, "write pool is in recovery")
+		return
+	}
+
+	writeProbe(w, true, "ready")
+}
+
+func writeProbe(w http.ResponseWriter, ok bool, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, msg)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// openPool открывает пул PostgreSQL, в котором у каждого соединения свой срок
+// жизни (connLifetime). SetConnMaxLifetime задаёт один срок всем соединениям
+// пула, и открытые вместе соединения вместе же и истекают.
+func openPool(dsn string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidDSN, err)
+	}
+	return sql.OpenDB(lifetimeConnector{connector}), nil
+}
+
+type lifetimeConnector struct {
+	driver.Connector
+}
+
+// pqConn — интерфейсы соединения lib/pq, которые использует database/sql
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (c lifetimeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, ok := conn.(pqConn)
+	lifetime := connLifetime()
+	if !ok || lifetime <= 0 {
+		return conn, nil
+	}
+	return &expiringConn{pqConn: pc, expires: clock.Now().Add(lifetime)}, nil
+}
+
+// expiringConn — соединение со своим сроком жизни. Истёкшее соединение
+// database/sql закрывает при возврате в пул (IsValid) или перед повторным
+// использованием из простоя (ResetSession), запрос при этом получает другое.
+type expiringConn struct {
+	pqConn
+	expires time.Time
+}
+
+func (c *expiringConn) expired() bool {
+	return !clock.Now().Before(c.expires)
+}
+
+func (c *expiringConn) IsValid() bool {
+	return !c.expired() && c.pqConn.IsValid()
+}
+
+func (c *expiringConn) ResetSession(ctx context.Context) error {
+	if c.expired() {
+		return driver.ErrBadConn
+	}
+	return c.pqConn.ResetSession(ctx)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// roleCounters — счётчики по пулу, обслужившему запрос (метка db_role)
+type roleCounters struct {
+	requests atomic.Int64
+	queries  atomic.Int64
+	dbNanos  atomic.Int64
+}
+
+// dbRoles — значения метки db_role; "none" — запрос не обращался к пулам
+var dbRoles = []string{"read", "write", "none"}
+
+var roleMetrics = map[string]*roleCounters{
+	"read":  {},
+	"write": {},
+	"none":  {},
+}
+
+// recordRoleMetrics добавляет завершённый запрос к счётчикам его db_role
+func recordRoleMetrics(stats *requestStats) {
+	role := stats.dbRole
+	if role == "" {
+		role = "none"
+	}
+
+	c := roleMetrics[role]
+	c.requests.Add(1)
+	c.queries.Add(int64(stats.dbQueries.Load()))
+	c.dbNanos.Add(stats.dbNanos.Load())
+}
+
+// metricsHandler отдаёт метрики в текстовом формате Prometheus.
+// Статистика пулов читается из sql.DB.Stats() в момент опроса.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	pools := namedPools()
+	stats := make([]sql.DBStats, len(pools))
+	for i, p := range pools {
+		stats[i] = p.db.Stats()
+	}
+
+	writeMetricHeader(w, "ms_app_db_pool_wait_count_total", "counter",
+		"Total number of connections waited for because the pool was exhausted.")
+	for i, p := range pools {
+		fmt.Fprintf(w, "ms_app_db_pool_wait_count_total{pool=%q} %d\n", p.name, stats[i].WaitCount)
+	}
+
+	writeMetricHeader(w, "ms_app_db_pool_wait_seconds_total", "counter",
+		"Total time spent waiting for a connection.")
+	for i, p := range pools {
+		fmt.Fprintf(w, "ms_app_db_pool_wait_seconds_total{pool=%q} %g\n", p.name, stats[i].WaitDuration.Seconds())
+	}
+
+	writeMetricHeader(w, "ms_app_db_pool_in_use", "gauge", "Connections currently in use.")
+	for i, p := range pools {
+		fmt.Fprintf(w, "ms_app_db_pool_in_use{pool=%q} %d\n", p.name, stats[i].InUse)
+	}
+
+	writeMetricHeader(w, "ms_app_db_pool_open", "gauge", "Open connections, in use and idle.")
+	for i, p := range pools {
+		fmt.Fprintf(w, "ms_app_db_pool_open{pool=%q} %d\n", p.name, stats[i].OpenConnections)
+	}
+
+	writeMetricHeader(w, "ms_app_db_pool_max_open", "gauge", "Maximum number of open connections.")
+	for i, p := range pools {
+		fmt.Fprintf(w, "ms_app_db_pool_max_open{pool=%q} %d\n", p.name, stats[i].MaxOpenConnections)
+	}
+
+	writeMetricHeader(w, "ms_app_http_requests_total", "counter", "HTTP requests by the pool that served them.")
+	for _, role := range dbRoles {
+		fmt.Fprintf(w, "ms_app_http_requests_total{db_role=%q} %d\n", role, roleMetrics[role].requests.Load())
+	}
+
+	writeMetricHeader(w, "ms_app_db_queries_total", "counter", "DB queries by pool role.")
+	for _, role := range dbRoles {
+		fmt.Fprintf(w, "ms_app_db_queries_total{db_role=%q} %d\n", role, roleMetrics[role].queries.Load())
+	}
+
+	writeMetricHeader(w, "ms_app_db_query_seconds_total", "counter", "Time spent in DB queries by pool role.")
+	for _, role := range dbRoles {
+		fmt.Fprintf(w, "ms_app_db_query_seconds_total{db_role=%q} %g\n", role,
+			float64(roleMetrics[role].dbNanos.Load())/float64(time.Second))
+	}
+
+	writeMetricHeader(w, "ms_app_http_in_flight_requests", "gauge", "HTTP requests currently being served.")
+	fmt.Fprintf(w, "ms_app_http_in_flight_requests %d\n", inFlight.Load())
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queryTimeout (QUERY_TIMEOUT) — таймаут запросов к БД, если клиент не передал
+// X-Query-Timeout; перечитывается на SIGHUP
+var queryTimeout = newDurationSetting("QUERY_TIMEOUT", 10*time.Second)
+
+type ctxKey int
+
+const (
+	queryTimeoutKey ctxKey = iota
+	requestStatsKey
+	tenantPoolKey
+	endpointKey
+)
+
+// buildHandler собирает цепочку middleware вокруг роутера
+func buildHandler(mux http.Handler) http.Handler {
+	h := mux
+	h = withTenant(h)
+	h = withQueryTimeout(h)
+	h = withConcurrencyLimit(h)
+	h = withPerIPLimit(h)
+	h = withInFlight(h)
+	h = withHostCheck(h)
+	h = withRecovery(h)
+	h = withAccessLog(h)
+	h = withPing(h)
+	h = withServedBy(h)
+	return h
+}
+
+// withServedBy добавляет в каждый ответ X-Served-By (hostname инстанса) и
+// X-App-Version, чтобы при canary-выкатке за HAProxy видеть на стороне клиента,
+// какая сборка ответила. SERVED_BY_HEADERS=false выключает.
+func withServedBy(next http.Handler) http.Handler {
+	if !envBool("SERVED_BY_HEADERS", true) {
+		return next
+	}
+
+	hostname, _ := os.Hostname()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", hostname)
+		w.Header().Set("X-App-Version", version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withPing отвечает на GET/HEAD /ping до всех остальных middleware: без БД,
+// access-лога и метрик. Для внешних uptime-мониторов, которые опрашивают часто
+// и которым нужен только 200; состояние БД — в /health.
+func withPing(next http.Handler) http.Handler {
+	pong := []byte("pong\n")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(pong)
+	})
+}
+
+// withQueryTimeout разбирает заголовок X-Query-Timeout ("30s" или секунды числом)
+// и кладёт таймаут в контекст запроса. Значения вне QUERY_TIMEOUT_MIN..QUERY_TIMEOUT_MAX
+// отклоняются: таймаут в 1ms гарантированно истечёт и ничего не проверяет.
+func withQueryTimeout(next http.Handler) http.Handler {
+	minTimeout := envDuration("QUERY_TIMEOUT_MIN", 100*time.Millisecond)
+	maxTimeout := envDuration("QUERY_TIMEOUT_MAX", 60*time.Second)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get("X-Query-Timeout")
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout, err := parseTimeout(raw)
+		if err != nil || timeout <= 0 {
+			writeError(w, http.StatusBadRequest, errCodeValidation, "Invalid X-Query-Timeout header")
+			return
+		}
+
+		if timeout < minTimeout {
+			writeError(w, http.StatusBadRequest, errCodeValidation,
+				fmt.Sprintf("X-Query-Timeout is below minimum of %v", minTimeout))
+			return
+		}
+
+		if timeout > maxTimeout {
+			writeError(w, http.StatusBadRequest, errCodeValidation,
+				fmt.Sprintf("X-Query-Timeout exceeds maximum of %v", maxTimeout))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), queryTimeoutKey, timeout)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// inFlight — число запросов, которые сейчас обрабатываются
+var inFlight atomic.Int64
+
+func withInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withConcurrencyLimit ограничивает число одновременно выполняемых обработчиков
+// (MAX_CONCURRENT_REQUESTS, 0 — без лимита). Сверх лимита сразу отвечаем 503,
+// чтобы балансировщик отправил запрос на другой инстанс, а не копил очередь к БД.
+// Health-эндпоинты лимит не учитывают: иначе перегрузку примут за падение.
+func withConcurrencyLimit(next http.Handler) http.Handler {
+	limit := envInt("MAX_CONCURRENT_REQUESTS", 0)
+	if limit <= 0 {
+		return next
+	}
+
+	log.Printf("🚦 Concurrent requests limited to %d", limit)
+	sem := make(chan struct{}, limit)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, errCodeOverloaded, "too many concurrent requests")
+		}
+	})
+}
+
+// withPerIPLimit ограничивает число одновременных запросов от одного клиента
+// (MAX_PER_IP_CONCURRENT, 0 — без лимита). Адрес берётся через clientIP с учётом
+// доверенных прокси. Сверх лимита — 429: один клиент с медленными запросами не
+// займёт весь пул, даже если запросов у него немного.
+func withPerIPLimit(next http.Handler) http.Handler {
+	limit := envInt("MAX_PER_IP_CONCURRENT", 0)
+	if limit <= 0 {
+		return next
+	}
+
+	log.Printf("🚦 Concurrent requests per client IP limited to %d", limit)
+
+	var (
+		mu     sync.Mutex
+		active = map[string]int{}
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+
+		mu.Lock()
+		if active[ip] >= limit {
+			mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, errCodeTooManyRequests, "too many concurrent requests from this client")
+			return
+		}
+		active[ip]++
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			// Удаляем нулевые записи, чтобы карта не росла с числом клиентов
+			if active[ip]--; active[ip] == 0 {
+				delete(active, ip)
+			}
+			mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isHealthPath(path string) bool {
+	return path == "/health" || strings.HasPrefix(path, "/healthz/")
+}
+
+// withRecovery перехватывает панику в обработчике: логирует её со стеком
+// и request ID и отвечает клиенту 500 без подробностей
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Штатный способ оборвать ответ — отдаём серверу как есть
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.Printf("💥 Panic in %s %s (request_id=%s): %v\n%s",
+				r.Method, r.URL.Path, requestID(r.Context()), p, debug.Stack())
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Максимальная длина имени хоста по RFC 1035 (плюс ":порт")
+const maxHostLen = 255 + len(":65535")
+
+// withHostCheck при заданном ALLOWED_HOSTS (через запятую, ".example.com" — любой
+// поддомен) отклоняет запросы с пустым, слишком длинным или не входящим в список
+// Host. Без ALLOWED_HOSTS проверка выключена. Health-эндпоинты не проверяются:
+// HAProxy по умолчанию (option httpchk) шлёт HTTP/1.0 без Host.
+func withHostCheck(next http.Handler) http.Handler {
+	var allowed []string
+	for _, h := range strings.Split(getenv("ALLOWED_HOSTS"), ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			allowed = append(allowed, h)
+		}
+	}
+	if len(allowed) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Host == "" || len(r.Host) > maxHostLen {
+			writeError(w, http.StatusMisdirectedRequest, errCodeMisdirected, "Invalid Host header")
+			return
+		}
+
+		if !hostAllowed(r.Host, allowed) {
+			writeError(w, http.StatusMisdirectedRequest, errCodeMisdirected, "Host is not allowed")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hostAllowed(host string, allowed []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, a := range allowed {
+		if host == a || (strings.HasPrefix(a, ".") && strings.HasSuffix(host, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTimeout(raw string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return time.ParseDuration(raw)
+}
+
+// queryContext возвращает контекст для запросов к БД в рамках HTTP-запроса:
+// таймаут из X-Query-Timeout, если он был передан, иначе def
+func queryContext(r *http.Request, def time.Duration) (context.Context, context.CancelFunc) {
+	timeout := def
+	if t, ok := r.Context().Value(queryTimeoutKey).(time.Duration); ok {
+		timeout = t
+	}
+
+	if stats := requestStatsFrom(r.Context()); stats != nil {
+		stats.queryTimeout.Store(int64(timeout))
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
+}
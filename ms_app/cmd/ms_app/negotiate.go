@@ -0,0 +1,66 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiate выбирает из offers тип, который клиент предпочитает по заголовку Accept.
+// Без Accept или при равных приоритетах побеждает первый из offers.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], -1.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	if bestQ <= 0 {
+		return offers[0]
+	}
+	return best
+}
+
+// acceptQuality возвращает q для типа offer: берётся самый точный подходящий
+// диапазон (type/subtype, затем type/*, затем */*)
+func acceptQuality(accept, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch {
+		case mediaType == offer:
+			s = 2
+		case mediaType == offerType+"/*":
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		partQ := 1.0
+		if raw, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(raw, 64); err == nil {
+				partQ = v
+			}
+		}
+		q, specificity = partQ, s
+	}
+
+	return q
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ItemResult — итог одного элемента пакета в режиме ?partial=true
+type ItemResult struct {
+	Index   int               `json:"index"`
+	Success bool              `json:"success"`
+	Status  string            `json:"status,omitempty"` // created / updated
+	ID      *userID           `json:"id,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// batchItemFunc записывает один элемент в транзакции tx и возвращает
+// пользователя и статус (created / updated)
+type batchItemFunc func(ctx context.Context, tx *sql.Tx, in UserInput) (User, string, error)
+
+// partialRequested — клиент просит обработать пакет поэлементно (?partial=true)
+func partialRequested(r *http.Request) bool {
+	return r.URL.Query().Get("partial") == "true"
+}
+
+// writePartialBatch обрабатывает каждый элемент пакета независимо, в своей
+// транзакции на одном соединении: ошибка в одной строке не отменяет остальные.
+// При MAX_USERS транзакции SERIALIZABLE, как в остальных путях записи.
+// Отвечает 200 с массивом ItemResult в порядке входных элементов.
+func writePartialBatch(w http.ResponseWriter, r *http.Request, pool *sql.DB, write batchItemFunc) {
+	inputs, ok := readBatchInputs(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		writeDBError(w, r, err, "Database query failed")
+		return
+	}
+	defer conn.Close()
+
+	results := make([]ItemResult, len(inputs))
+	var created, updated []User
+	for i := range inputs {
+		results[i].Index = i
+
+		if e := validateUserInput(&inputs[i]); e != nil {
+			results[i].Code, results[i].Error, results[i].Details = e.Code, e.Error, e.Details
+			continue
+		}
+
+		var (
+			user   User
+			status string
+		)
+		err := withUserLimitTx(ctx, conn, func(tx *sql.Tx) error {
+			var err error
+			user, status, err = write(ctx, tx, inputs[i])
+			return err
+		})
+		if err != nil {
+			results[i].Code, results[i].Error = itemError(ctx, err)
+			continue
+		}
+
+		id := user.ID
+		results[i].Success, results[i].Status, results[i].ID = true, status, &id
+		if status == "created" {
+			created = append(created, user)
+		} else {
+			updated = append(updated, user)
+		}
+	}
+
+	if len(created)+len(updated) > 0 {
+		markWrite(w)
+	}
+	emitUserEvent(eventUserCreated, created...)
+	emitUserEvent(eventUserUpdated, updated...)
+	writeJSON(w, http.StatusOK, results)
+}
+
+// itemError переводит ошибку записи элемента в код и сообщение ItemResult.
+// Коды те же, что у writeDBError; текст ошибки драйвера (сообщения и имена
+// ограничений PostgreSQL) клиенту не отдаётся, только в лог.
+func itemError(ctx context.Context, err error) (code, message string) {
+	if errors.Is(err, errUserLimitReached) {
+		return errCodeUserLimit, fmt.Sprintf("User limit of %d reached", maxUsers)
+	}
+	if _, ok := uniqueViolation(err); ok {
+		return errCodeDuplicateEmail, "Email already exists"
+	}
+
+	logDBError(ctx, "Batch item failed", err)
+	_, code, message = dbErrorReply(err)
+	if message == "" {
+		message = "Database query failed"
+	}
+	return code, message
+}
+
+// createBatchItem — элемент POST /users/batch?partial=true
+func createBatchItem(ctx context.Context, tx *sql.Tx, in UserInput) (User, string, error) {
+	if err := checkUserLimit(ctx, tx, 1); err != nil {
+		return User{}, "", err
+	}
+
+	query, args := batchInsertQuery([]UserInput{in})
+	users, err := insertChunk(ctx, tx, query, args)
+	if err != nil {
+		return User{}, "", err
+	}
+	if len(users) == 0 {
+		return User{}, "", sql.ErrNoRows
+	}
+	return users[0], "created", nil
+}
+
+// upsertBatchItem — элемент POST /users/upsert?partial=true
+func upsertBatchItem(ctx context.Context, tx *sql.Tx, in UserInput) (User, string, error) {
+	created, updated, err := upsertChunk(ctx, tx, []UserInput{in})
+	if err != nil {
+		return User{}, "", err
+	}
+	if len(updated) > 0 {
+		return updated[0], "updated", nil
+	}
+	if len(created) == 0 {
+		return User{}, "", sql.ErrNoRows
+	}
+
+	// Новая строка уже вставлена — превышение лимита откатывает транзакцию
+	if err := checkUserLimit(ctx, tx, 0); err != nil {
+		return User{}, "", err
+	}
+	return created[0], "created", nil
+}
+
+// checkUserLimit возвращает errUserLimitReached, если после добавления adding
+// строк пользователей станет больше MAX_USERS
+func checkUserLimit(ctx context.Context, tx *sql.Tx, adding int) error {
+	if maxUsers <= 0 {
+		return nil
+	}
+
+	var count int
+	if err := dbQueryRow(ctx, tx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return err
+	}
+	if count+adding > maxUsers {
+		return errUserLimitReached
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// startPoolStatsLogger раз в DB_STATS_LOG_INTERVAL пишет в лог статистику пулов,
+// чтобы видеть, как закрываются простаивающие и состарившиеся соединения.
+// По умолчанию выключено.
+func startPoolStatsLogger() {
+	interval := envDuration("DB_STATS_LOG_INTERVAL", 0)
+	if interval <= 0 {
+		return
+	}
+
+	log.Printf("📈 Logging connection pool stats every %v", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for _, p := range namedPools() {
+				logPoolStats(p.name, p.db)
+			}
+		}
+	}()
+}
+
+type namedPool struct {
+	name string
+	db   *sql.DB
+}
+
+// namedPools — основной, резервный и read-пулы под именами для логов и /metrics
+func namedPools() []namedPool {
+	var pools []namedPool
+	if db != nil {
+		pools = append(pools, namedPool{"main", db})
+	}
+	if standbyDB != nil {
+		pools = append(pools, namedPool{"standby", standbyDB})
+	}
+	for i, p := range readPools {
+		pools = append(pools, namedPool{fmt.Sprintf("read-%d", i+1), p.db})
+	}
+	return pools
+}
+
+// startPoolWaitMonitor следит за приростом WaitCount: каждый прирост — запрос,
+// которому не хватило свободного соединения из 25. Если за DB_WAIT_CHECK_INTERVAL
+// набралось не меньше DB_WAIT_WARN_THRESHOLD ожиданий, пишем предупреждение —
+// пора поднимать лимиты пула или число инстансов за балансировщиком.
+func startPoolWaitMonitor() {
+	interval := envDuration("DB_WAIT_CHECK_INTERVAL", 10*time.Second)
+	threshold := int64(envInt("DB_WAIT_WARN_THRESHOLD", 50))
+	if interval <= 0 || threshold <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := make(map[string]sql.DBStats)
+		for range ticker.C {
+			for _, p := range namedPools() {
+				st := p.db.Stats()
+				prev, seen := last[p.name]
+				last[p.name] = st
+				if !seen {
+					continue
+				}
+
+				waits := st.WaitCount - prev.WaitCount
+				if waits >= threshold {
+					log.Printf("⚠️  Pool %s exhausted: %d waits for a connection in %v (waited %v total, in_use=%d/%d)",
+						p.name, waits, interval, st.WaitDuration-prev.WaitDuration, st.InUse, st.MaxOpenConnections)
+				}
+			}
+		}
+	}()
+}
+
+func logPoolStats(name string, pool *sql.DB) {
+	st := pool.Stats()
+	log.Printf("📈 Pool %s: open=%d in_use=%d idle=%d wait_count=%d max_idle_closed=%d max_idle_time_closed=%d max_lifetime_closed=%d",
+		name, st.OpenConnections, st.InUse, st.Idle, st.WaitCount,
+		st.MaxIdleClosed, st.MaxIdleTimeClosed, st.MaxLifetimeClosed)
+}
+
+// watchStatsSignal по SIGUSR2 пишет в лог полный снимок всех пулов и число
+// горутин: kill -USR2 <pid> во время инцидента без открытия эндпоинтов
+func watchStatsSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+
+	go func() {
+		for range sigs {
+			log.Printf("📸 Stats snapshot: goroutines=%d in_flight=%d", runtime.NumGoroutine(), inFlight.Load())
+			pools := namedPools()
+			if len(pools) == 0 {
+				log.Println("📸 No database pools open")
+			}
+			for _, p := range pools {
+				st := p.db.Stats()
+				log.Printf("📸 Pool %s: max_open=%d open=%d in_use=%d idle=%d wait_count=%d wait_duration=%v max_idle_closed=%d max_idle_time_closed=%d max_lifetime_closed=%d",
+					p.name, st.MaxOpenConnections, st.OpenConnections, st.InUse, st.Idle,
+					st.WaitCount, st.WaitDuration, st.MaxIdleClosed, st.MaxIdleTimeClosed, st.MaxLifetimeClosed)
+			}
+		}
+	}()
+}
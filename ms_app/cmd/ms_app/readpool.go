@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Интервал проверки реплик, сопоставим с "inter 3s" в haproxy.cfg
+const readPoolCheckInterval = 5 * time.Second
+
+// readPool — отдельный пул соединений к одной реплике
+type readPool struct {
+	dsn     string
+	db      *sql.DB
+	healthy atomic.Bool
+	checked bool
+}
+
+var (
+	readPools []*readPool
+	readNext  atomic.Uint64
+)
+
+// initReadPools открывает пулы для DSN из DB_READ_URLS (через запятую).
+// Если переменная не задана, чтение идёт через основной пул (HAProxy).
+func initReadPools() {
+	raw := getenv("DB_READ_URLS")
+	if raw == "" {
+		log.Println("Read pools not configured, reads go through the main pool (HAProxy mode)")
+		return
+	}
+
+	for _, dsn := range strings.Split(raw, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+
+		pool, err := openPool(dsn)
+		if err != nil {
+			log.Printf("⚠️  Skipping read pool %s: %v", maskPassword(dsn), err)
+			continue
+		}
+		configurePool(pool)
+
+		p := &readPool{dsn: dsn, db: pool}
+		p.ping()
+		readPools = append(readPools, p)
+	}
+
+	log.Printf("📚 App-side read balancing enabled across %d pools", len(readPools))
+	go monitorReadPools()
+}
+
+func (p *readPool) ping() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.db.PingContext(ctx)
+	wasHealthy := p.healthy.Swap(err == nil)
+	first := !p.checked
+	p.checked = true
+
+	// Логируем только смену состояния (и первую проверку)
+	if err != nil && (wasHealthy || first) {
+		log.Printf("❌ Read pool %s is down: %v", maskPassword(p.dsn), err)
+	} else if err == nil && !wasHealthy {
+		log.Printf("✅ Read pool %s is up", maskPassword(p.dsn))
+	}
+}
+
+func monitorReadPools() {
+	ticker := time.NewTicker(readPoolCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, p := range readPools {
+			p.ping()
+		}
+	}
+}
+
+// readDB выбирает пул для запроса на чтение: round-robin по репликам,
+// чей последний ping прошёл успешно. Если живых реплик нет — основной пул.
+// Сразу после записи этого клиента (см. markWrite) читаем из основного пула.
+// Запросы тенанта всегда идут в его пул.
+func readDB(r *http.Request) *sql.DB {
+	// У тенантов нет отдельных реплик
+	if pool := tenantPoolFrom(r.Context()); pool != nil {
+		return withDBRole(r, "write", pool)
+	}
+
+	n := uint64(len(readPools))
+	if n == 0 || recentlyWrote(r) {
+		return withDBRole(r, "write", activeDB())
+	}
+
+	start := readNext.Add(1)
+	for i := uint64(0); i < n; i++ {
+		p := readPools[(start+i)%n]
+		if p.healthy.Load() {
+			return withDBRole(r, "read", p.db)
+		}
+	}
+
+	return withDBRole(r, "write", activeDB())
+}
+
+// withDBRole запоминает в статистике запроса, какой пул его обслужил
+// (для access log и метрик с меткой db_role)
+func withDBRole(r *http.Request, role string, pool *sql.DB) *sql.DB {
+	if stats := requestStatsFrom(r.Context()); stats != nil && pool != nil {
+		stats.dbRole = role
+	}
+	return pool
+}
+
+// Read-your-writes: после записи клиент получает cookie, и в течение
+// READ_YOUR_WRITES_WINDOW его чтения идут в пул записи, а не на реплики,
+// которые могут отставать. Cookie работает и когда Nginx отправит следующий
+// запрос на другой инстанс. 0 — выключено.
+const rywCookie = "ms_ryw_until"
+
+var rywWindow = envDuration("READ_YOUR_WRITES_WINDOW", 0)
+
+func markWrite(w http.ResponseWriter) {
+	if rywWindow <= 0 || len(readPools) == 0 {
+		return
+	}
+
+	until := time.Now().Add(rywWindow)
+	http.SetCookie(w, &http.Cookie{
+		Name:     rywCookie,
+		Value:    strconv.FormatInt(until.UnixMilli(), 10),
+		Path:     "/",
+		Expires:  until,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func recentlyWrote(r *http.Request) bool {
+	if rywWindow <= 0 {
+		return false
+	}
+
+	c, err := r.Cookie(rywCookie)
+	if err != nil {
+		return false
+	}
+
+	until, err := strconv.ParseInt(c.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	// Окно не может быть больше настроенного, даже если cookie подделан
+	remaining := time.Until(time.UnixMilli(until))
+	return remaining > 0 && remaining <= rywWindow
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Перечитать настройки можно только там, где они могут поменяться без
+// перезапуска процесса: окружение процесса неизменно, поэтому на SIGHUP
+// меняются лишь значения, переданные через <KEY>_FILE (например, ConfigMap,
+// смонтированный файлами).
+
+// durationSetting — длительность из окружения, которую можно перечитать на лету
+type durationSetting struct {
+	key string
+	def time.Duration
+	v   atomic.Int64
+}
+
+func newDurationSetting(key string, def time.Duration) *durationSetting {
+	s := &durationSetting{key: key, def: def}
+	s.v.Store(int64(envDuration(key, def)))
+	return s
+}
+
+func (s *durationSetting) Get() time.Duration {
+	return time.Duration(s.v.Load())
+}
+
+// reload перечитывает значение и сообщает, изменилось ли оно
+func (s *durationSetting) reload() (old, cur time.Duration, changed bool) {
+	cur = envDuration(s.key, s.def)
+	old = time.Duration(s.v.Swap(int64(cur)))
+	return old, cur, old != cur
+}
+
+// reloadableDurations — таймауты, которые применяются на SIGHUP
+var reloadableDurations = []*durationSetting{queryTimeout, exportTimeout}
+
+// poolSettings — параметры пула из configurePool
+type poolSettings struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	maxIdleTime time.Duration
+	dnsRefresh  time.Duration
+}
+
+func currentPoolSettings() poolSettings {
+	return poolSettings{
+		maxOpen:     envInt("DB_MAX_OPEN_CONNS", 25),
+		maxIdle:     envInt("DB_MAX_IDLE_CONNS", 25),
+		maxLifetime: envDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		maxIdleTime: envDuration("DB_CONN_MAX_IDLE_TIME", 0),
+		dnsRefresh:  envDuration("DNS_REFRESH", 0),
+	}
+}
+
+// restartOnlyKeys — настройки, для которых нужно переподключение или новый
+// listener; на SIGHUP они только сравниваются с прочитанными при старте
+var restartOnlyKeys = []string{
+	"DATABASE_URL", "DB_PROFILE", "DB_FALLBACK_URLS", "DB_READ_URLS",
+	"STANDBY_DATABASE_URL", "TENANT_DSNS", "TENANT_DSN_TEMPLATE",
+	"PORT", "LISTEN_SOCKET", "ADMIN_PORT",
+}
+
+var startupValues = map[string]string{}
+
+// watchReloadSignal перечитывает безопасное подмножество настроек по SIGHUP:
+// размеры и время жизни соединений во всех пулах и таймауты запросов
+func watchReloadSignal() {
+	for _, key := range restartOnlyKeys {
+		startupValues[key] = getenv(key)
+	}
+	applied := currentPoolSettings()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			log.Println("🔄 SIGHUP received, reloading configuration")
+			applied = reloadConfig(applied)
+		}
+	}()
+}
+
+func reloadConfig(applied poolSettings) poolSettings {
+	reloadFileEnv()
+	changes := 0
+
+	for _, s := range reloadableDurations {
+		if old, cur, changed := s.reload(); changed {
+			log.Printf("🔄 %s: %v -> %v", s.key, old, cur)
+			changes++
+		}
+	}
+
+	next := currentPoolSettings()
+	if next != applied {
+		log.Printf("🔄 Pool settings: max_open %d -> %d, max_idle %d -> %d, max_lifetime %v -> %v, max_idle_time %v -> %v, dns_refresh %v -> %v",
+			applied.maxOpen, next.maxOpen, applied.maxIdle, next.maxIdle,
+			applied.maxLifetime, next.maxLifetime, applied.maxIdleTime, next.maxIdleTime,
+			applied.dnsRefresh, next.dnsRefresh)
+
+		for _, p := range namedPools() {
+			configurePool(p.db)
+		}
+		tenantPoolsMu.Lock()
+		for _, pool := range tenantPools {
+			configurePool(pool)
+		}
+		tenantPoolsMu.Unlock()
+		changes++
+	}
+
+	for _, key := range restartOnlyKeys {
+		if getenv(key) != startupValues[key] {
+			log.Printf("⚠️  %s changed, restart required to apply it", key)
+		}
+	}
+
+	if changes == 0 {
+		log.Println("🔄 No reloadable settings changed")
+	}
+	return next
+}
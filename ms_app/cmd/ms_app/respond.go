@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Машиночитаемые коды ошибок для клиентов
+const (
+	errCodeDBUnavailable       = "db_unavailable"
+	errCodeDBQueryFailed       = "db_query_failed"
+	errCodeDuplicateEmail      = "duplicate_email"
+	errCodeValidation          = "validation_failed"
+	errCodeMethodNotAllowed    = "method_not_allowed"
+	errCodeReadOnly            = "read_only"
+	errCodeUserLimit           = "user_limit_reached"
+	errCodeNotFound            = "not_found"
+	errCodeMisdirected         = "misdirected_request"
+	errCodeInternal            = "internal_error"
+	errCodeDBBusy              = "db_busy"
+	errCodeUserNotFound        = "user_not_found"
+	errCodeCircuitOpen         = "circuit_open"
+	errCodeUnknownTenant       = "unknown_tenant"
+	errCodeQueryTimeout        = "query_timeout"
+	errCodeForbidden           = "forbidden"
+	errCodeOverloaded          = "overloaded"
+	errCodeInitializing        = "initializing"
+	errCodeTooManyRequests     = "too_many_requests"
+	errCodeTenantPoolExhausted = "tenant_pool_exhausted"
+)
+
+// ErrorResponse — единый формат JSON-ошибки
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Лимит тела JSON-запроса, как client_max_body_size в nginx.conf
+const maxBodyBytes = 10 << 20
+
+// strictJSON (STRICT_JSON) — отклонять JSON с неизвестными полями, чтобы опечатка
+// клиента ("emal" вместо "email") не превращалась в молча пропущенное поле
+var strictJSON = envBool("STRICT_JSON", false)
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// writeDecodeError отвечает 400 на ошибку decodeJSON. Неизвестное поле
+// (STRICT_JSON) называется отдельно в details.field.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	// encoding/json не экспортирует тип этой ошибки, только текст
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{
+			Error:   fmt.Sprintf("Unknown field %q", field),
+			Code:    errCodeValidation,
+			Details: map[string]string{"field": field},
+		})
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, errCodeValidation, fmt.Sprintf("Invalid JSON body: %v", err))
+}
+
+// writeJSON пишет v как JSON. Списки всегда отдаются как [], а не null:
+// nil-срез ответа заменяется пустым, поэтому обработчикам не нужно
+// инициализировать результат вручную. На вложенные поля правило не действует.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		v = reflect.MakeSlice(rv.Type(), 0, 0).Interface()
+	}
+
+	body, err := marshalResponse(v)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"Failed to encode response","code":"internal_error"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// allowMethods пропускает запрос, если его метод в списке, иначе отвечает
+// 405 с заголовком Allow, перечисляющим поддерживаемые методы пути
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+// writeHead отвечает на HEAD только заголовками. net/http и так отбрасывает
+// тело HEAD-ответа, но обработчик при этом всё равно рендерит страницу и
+// выполняет запросы — на частых HEAD-пробах это лишняя работа.
+func writeHead(w http.ResponseWriter, status int, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+}
+
+// jsonCamelCase (JSON_CASE=camel) — отдавать ключи в camelCase вместо snake_case
+var jsonCamelCase = getenv("JSON_CASE") == "camel"
+
+func marshalResponse(v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil || !jsonCamelCase {
+		return body, err
+	}
+
+	// Перекодируем через interface{}, чтобы переименовать ключи на любой глубине
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(camelizeKeys(generic))
+}
+
+func camelizeKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[snakeToCamel(k)] = camelizeKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i := range t {
+			t[i] = camelizeKeys(t[i])
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// snakeToCamel: "db_host" -> "dbHost"
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message, Code: code})
+}
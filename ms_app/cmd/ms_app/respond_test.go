@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONNilSliceIsEmptyArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, []User(nil))
+
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Fatalf("body = %s, want []", got)
+	}
+}
+
+func TestUsersEmptyListIsArray(t *testing.T) {
+	useFakeDB(t, func(query string) (driver.Rows, error) {
+		if strings.Contains(query, "COUNT(*)") {
+			return countRows(0), nil
+		}
+		return userRows(0, -1, nil), nil
+	})
+
+	rec := httptest.NewRecorder()
+	usersHandler(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Fatalf("body = %s, want []", got)
+	}
+}
+
+func TestConnectionTargetAttemptsIsArray(t *testing.T) {
+	connectionAttemptsMu.Lock()
+	prev := connectionAttempts
+	connectionAttempts = nil
+	connectionAttemptsMu.Unlock()
+	t.Cleanup(func() {
+		connectionAttemptsMu.Lock()
+		connectionAttempts = prev
+		connectionAttemptsMu.Unlock()
+	})
+
+	rec := httptest.NewRecorder()
+	connectionTargetHandler(rec, httptest.NewRequest(http.MethodGet, "/diag/connection-target", nil))
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if got := string(body["attempts"]); got != "[]" {
+		t.Fatalf("attempts = %s, want []", got)
+	}
+}
+
+func TestResponseTimestampsFollowTimeFormat(t *testing.T) {
+	prev := timeFormat
+	timeFormat = "unix"
+	t.Cleanup(func() { timeFormat = prev })
+
+	now := time.Unix(1700000000, 0)
+	body, err := json.Marshal(struct {
+		Health  HealthResponse
+		Attempt ConnectionAttempt
+	}{
+		HealthResponse{Timestamp: jsonTime{now}},
+		ConnectionAttempt{Time: &jsonTime{now}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(body), ":1700000000"); got != 2 {
+		t.Fatalf("body = %s, want both timestamps as unix seconds", body)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// route — HTTP-маршрут приложения. Если feature задан, маршрут
+// можно выключить переменной окружения FEATURE_<FEATURE>=false.
+// Маршруты admin при заданном ADMIN_PORT обслуживаются только на внутреннем порту.
+// Маршруты debug регистрируются только на отдельном ADMIN_PORT и только с DEBUG=true.
+type route struct {
+	name    string // имя эндпоинта для тегов SQL-запросов
+	pattern string
+	feature string
+	admin   bool
+	debug   bool
+	handler http.HandlerFunc
+}
+
+func appRoutes() []route {
+	return []route{
+		{name: "home", pattern: "/{$}", feature: "home", handler: homeHandler},
+		{name: "health", pattern: "/health", handler: healthHandler},
+		{name: "live", pattern: "/healthz/live", handler: liveHandler},
+		{name: "ready", pattern: "/healthz/ready", handler: readyHandler},
+		{name: "readyRead", pattern: "/healthz/ready/read", handler: readyReadHandler},
+		{name: "readyWrite", pattern: "/healthz/ready/write", handler: readyWriteHandler},
+		{name: "listUsers", pattern: "/users", feature: "users", handler: usersHandler},
+		{name: "createUser", pattern: "/users/create", feature: "users_create", handler: createUserHandler},
+		{name: "batchCreateUsers", pattern: "/users/batch", feature: "users_batch", handler: batchCreateHandler},
+		{name: "upsertUsers", pattern: "/users/upsert", feature: "users_batch", handler: upsertUsersHandler},
+		{name: "userByEmail", pattern: "/users/by-email", feature: "users", handler: userByEmailHandler},
+		{name: "randomUser", pattern: "/users/random", feature: "users", handler: randomUserHandler},
+		{name: "exportUsers", pattern: "/users/export", feature: "users_export", handler: exportUsersHandler},
+		{name: "patchUser", pattern: "/users/{id}", feature: "users_update", handler: patchUserHandler},
+		{name: "diagLatency", pattern: "/diag/latency", feature: "diag", admin: true, handler: latencyHandler},
+		{name: "diagBackends", pattern: "/diag/backends", feature: "diag", admin: true, handler: backendsHandler},
+		{name: "diagConnectionTarget", pattern: "/diag/connection-target", feature: "diag", admin: true, handler: connectionTargetHandler},
+		{name: "metrics", pattern: "/metrics", feature: "metrics", admin: true, handler: metricsHandler},
+		{name: "dashboard", pattern: "/dashboard", feature: "dashboard", admin: true, handler: dashboardHandler},
+		{name: "diagTableSize", pattern: "/diag/table-size", feature: "diag", admin: true, handler: tableSizeHandler},
+		// Отдаёт и Cookie/Authorization, поэтому на публичный порт не попадает никогда
+		{name: "debugEcho", pattern: "/debug/echo", feature: "debug_echo", admin: true, debug: true, handler: echoHandler},
+	}
+}
+
+// featureEnabled читает флаг FEATURE_<NAME> (true/false, 1/0).
+// Незаданный или некорректный флаг означает значение по умолчанию.
+func featureEnabled(name string, def bool) bool {
+	return envBool("FEATURE_"+strings.ToUpper(name), def)
+}
+
+// registeredRoutes — включённые публичные маршруты, заполняется в registerRoutes
+var registeredRoutes []string
+
+// debugEndpoints (DEBUG) — включает отладочные маршруты на ADMIN_PORT
+var debugEndpoints = envBool("DEBUG", false)
+
+// registerRoutes регистрирует включённые маршруты: admin-маршруты в adminMux,
+// остальные в mux. Без отдельного admin-порта оба аргумента — один и тот же mux,
+// и admin-маршруты закрываются ADMIN_ALLOWED_IPS поштучно (admin-сервер
+// проверяет allowlist для всего mux сам).
+// Выключенные и неизвестные пути отвечают 404 через notFoundHandler.
+func registerRoutes(mux, adminMux *http.ServeMux) {
+	for _, rt := range appRoutes() {
+		if rt.feature != "" && !featureEnabled(rt.feature, true) {
+			log.Printf("🚫 Route %s disabled by FEATURE_%s", rt.pattern, strings.ToUpper(rt.feature))
+			continue
+		}
+
+		if rt.debug && (adminMux == mux || !debugEndpoints) {
+			debugf("Debug route %s is not registered: requires ADMIN_PORT and DEBUG=true", rt.pattern)
+			continue
+		}
+
+		target := mux
+		handler := rt.handler
+		if rt.admin {
+			target = adminMux
+			if adminMux == mux {
+				handler = withAdminAllowlist(handler).ServeHTTP
+			}
+		}
+
+		target.Handle(rt.pattern, withEndpoint(rt.name, handler))
+		if target == mux {
+			registeredRoutes = append(registeredRoutes, strings.TrimSuffix(rt.pattern, "{$}"))
+		}
+	}
+
+	mux.HandleFunc("/", notFoundHandler)
+	if adminMux != mux {
+		adminMux.HandleFunc("/", notFoundHandler)
+	}
+}
+
+// notFoundHandler отвечает JSON 404 на любой неизвестный путь: HTML-страница
+// на месте 404 маскирует ошибки маршрутизации за прокси
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, errCodeNotFound, "not found")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnknownPathReturnsJSON404(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, mux)
+	handler := buildHandler(mux)
+
+	for _, accept := range []string{"", "*/*"} {
+		req := httptest.NewRequest(http.MethodGet, "/totally/unknown", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Accept %q: status = %d, want %d", accept, rec.Code, http.StatusNotFound)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Fatalf("Accept %q: Content-Type = %q, want application/json", accept, ct)
+		}
+
+		var body ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Accept %q: body is not JSON: %v", accept, err)
+		}
+		if body.Code != errCodeNotFound {
+			t.Fatalf("Accept %q: code = %q, want %q", accept, body.Code, errCodeNotFound)
+		}
+	}
+}
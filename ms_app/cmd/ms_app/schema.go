@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Индексы для поиска по email. Уникальное ограничение покрывает только точное
+// совпадение; для ILIKE '%...%' нужен триграммный GIN-индекс из pg_trgm.
+// Если расширение недоступно (нет прав, managed PostgreSQL), создаём btree по
+// lower(email), который ускоряет хотя бы префиксный поиск.
+const (
+	trgmExtensionSQL = `CREATE EXTENSION IF NOT EXISTS pg_trgm`
+	trgmIndexSQL     = `CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING gin (email gin_trgm_ops)`
+	patternIndexSQL  = `CREATE INDEX IF NOT EXISTS users_email_pattern_idx ON users (lower(email) text_pattern_ops)`
+)
+
+// migrationLockKey — ключ pg_advisory_lock для схемы. При одновременном старте
+// многих инстансов миграции выполняет один, остальные ждут: параллельные
+// CREATE EXTENSION/CREATE INDEX приводили к дедлокам.
+const migrationLockKey = 0x6d735f617070 // "ms_app"
+
+// lockMigrations берёт advisory lock на соединении conn и возвращает функцию
+// освобождения. Если соединение оборвётся, PostgreSQL снимет блокировку сам.
+func lockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+	start := time.Now()
+	if _, err := dbExec(ctx, conn, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	if waited := time.Since(start); waited > time.Second {
+		log.Printf("🔒 Waited %v for another instance to finish migrations", waited.Round(time.Millisecond))
+	}
+
+	return func() {
+		// ctx миграций к этому моменту может уже истечь
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := dbExec(unlockCtx, conn, "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			log.Printf("⚠️  Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// schemaVersionSQL — журнал применённых миграций (номер — позиция в migrations)
+const schemaVersionSQL = `CREATE TABLE IF NOT EXISTS schema_version (
+	version INT PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// schemaVersion возвращает номер последней применённой миграции, 0 — ни одной.
+// На базе, созданной до schema_version, все миграции выполнятся один раз
+// повторно: они идемпотентны (IF NOT EXISTS, UPDATE ... WHERE ... IS NULL).
+func schemaVersion(ctx context.Context, q queryer) (int, error) {
+	if _, err := dbExec(ctx, q, schemaVersionSQL); err != nil {
+		return 0, fmt.Errorf("failed to create schema_version: %w", err)
+	}
+	return readSchemaVersion(ctx, q)
+}
+
+// readSchemaVersion читает номер последней миграции, ничего не создавая
+// (для DB_DRY_RUN): нет таблицы schema_version — 0
+func readSchemaVersion(ctx context.Context, q queryer) (int, error) {
+	var version int
+	err := dbQueryRow(ctx, q,
+		`SELECT CASE WHEN to_regclass('schema_version') IS NULL THEN 0
+		ELSE (SELECT COALESCE(MAX(version), 0) FROM schema_version) END`,
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// createEmailIndexes не прерывает запуск: ошибки только логируются
+func createEmailIndexes(ctx context.Context, q queryer) {
+	// CREATE INDEX IF NOT EXISTS берёт SHARE lock на users, даже если индекс уже
+	// есть, поэтому сначала смотрим в каталог. В DB_DRY_RUN без подключения
+	// (q == nil) проверить нельзя.
+	if q != nil {
+		var exists bool
+		err := dbQueryRow(ctx, q,
+			`SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE tablename = 'users'
+			AND indexname IN ('users_email_trgm_idx', 'users_email_pattern_idx'))`,
+		).Scan(&exists)
+		if err == nil && exists {
+			debugf("Email search index already exists, skipping")
+			return
+		}
+	}
+
+	if dryRun {
+		log.Printf("📝 [dry-run] would execute: %s", trgmExtensionSQL)
+		log.Printf("📝 [dry-run] would execute: %s", trgmIndexSQL)
+		log.Printf("📝 [dry-run] fallback if pg_trgm is unavailable: %s", patternIndexSQL)
+		return
+	}
+
+	if _, err := dbExec(ctx, q, trgmExtensionSQL); err != nil {
+		log.Printf("⚠️  pg_trgm extension is not available: %v", err)
+		createFallbackEmailIndex(ctx, q)
+		return
+	}
+	log.Println("✅ pg_trgm extension is available")
+
+	if _, err := dbExec(ctx, q, trgmIndexSQL); err != nil {
+		log.Printf("⚠️  Could not create trigram index on users.email: %v", err)
+		createFallbackEmailIndex(ctx, q)
+		return
+	}
+	log.Println("✅ Trigram index users_email_trgm_idx checked/created")
+}
+
+func createFallbackEmailIndex(ctx context.Context, q queryer) {
+	if _, err := dbExec(ctx, q, patternIndexSQL); err != nil {
+		log.Printf("⚠️  Could not create fallback index on lower(email): %v", err)
+		return
+	}
+	log.Println("✅ Fallback index users_email_pattern_idx checked/created (prefix search only)")
+}
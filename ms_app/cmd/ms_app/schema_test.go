@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestDryRunListsOnlyPendingMigrations(t *testing.T) {
+	applied := len(migrations) - 2
+	useFakeDB(t, func(query string) (driver.Rows, error) {
+		switch {
+		case strings.Contains(query, "schema_version"):
+			return countRows(int64(applied)), nil
+		case strings.Contains(query, "pg_indexes"):
+			return countRows(1), nil
+		}
+		return nil, fmt.Errorf("unexpected query in dry-run: %s", query)
+	})
+
+	prevDryRun := dryRun
+	dryRun = true
+	prevLog := log.Writer()
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() {
+		dryRun = prevDryRun
+		log.SetOutput(prevLog)
+	})
+
+	if err := createTable(); err != nil {
+		t.Fatalf("createTable: %v", err)
+	}
+
+	for i := range migrations {
+		logged := strings.Contains(out.String(), fmt.Sprintf("migration %d/%d would execute", i+1, len(migrations)))
+		if want := i >= applied; logged != want {
+			t.Errorf("migration %d logged = %v, want %v\n%s", i+1, logged, want, out.String())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// runSelfTest проверяет путь до БД (обычно через HAProxy) без запуска HTTP-сервера:
+// подключение, создание схемы, затем создание, чтение и удаление тестового пользователя.
+// С DB_DRY_RUN не запускается: и миграции, и тестовый цикл пишут в БД.
+func runSelfTest() error {
+	if dryRun {
+		return errors.New("self-test writes to the database and cannot run with DB_DRY_RUN=true")
+	}
+
+	log.Println("🧪 Running self-test...")
+
+	if err := connectWithRetry(3); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	if err := createTable(); err != nil {
+		return fmt.Errorf("create table: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	name := "selftest"
+	email := fmt.Sprintf("selftest-%d@selftest.local", time.Now().UnixNano())
+
+	var id int
+	err := dbQueryRow(ctx, db,
+		"INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id",
+		name, email,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	log.Printf("  ✔ created user id=%d", id)
+
+	user, err := scanUser(dbQueryRow(ctx, db,
+		"SELECT "+userColumns+" FROM users WHERE id = $1", id,
+	))
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if user.Name != name || user.Email != email {
+		return fmt.Errorf("read: got %+v, want name=%q email=%q", user, name, email)
+	}
+	log.Printf("  ✔ read user id=%d", id)
+
+	res, err := dbExec(ctx, db, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return fmt.Errorf("delete: expected 1 row affected, got %d", n)
+	}
+	log.Printf("  ✔ deleted user id=%d", id)
+
+	return nil
+}
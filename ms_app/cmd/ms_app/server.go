@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// listen открывает Unix-сокет из LISTEN_SOCKET (удобно для Nginx на том же хосте),
+// иначе TCP-порт из PORT
+func listen() (net.Listener, string, error) {
+	if sock := getenv("LISTEN_SOCKET"); sock != "" {
+		// Удаляем сокет, оставшийся от прошлого запуска
+		if err := os.Remove(sock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", err
+		}
+
+		ln, err := net.Listen("unix", sock)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Nginx обычно работает под другим пользователем
+		if err := os.Chmod(sock, 0o666); err != nil {
+			ln.Close()
+			return nil, "", err
+		}
+
+		return ln, "unix:" + sock, nil
+	}
+
+	port := getenv("PORT")
+	if port == "" {
+		port = "3025"
+	}
+
+	ln, port, err := listenTCP(port)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if proxyProtocol {
+		ln = withProxyProtocol(ln)
+	}
+
+	return ln, "http://0.0.0.0:" + port, nil
+}
+
+// portAutoIncrement (PORT_AUTO_INCREMENT) — если порт занят, пробовать следующие
+// (до maxPortAttempts штук). Для локальной разработки, когда несколько
+// инстансов запускаются без явного PORT.
+var portAutoIncrement = envBool("PORT_AUTO_INCREMENT", false)
+
+const maxPortAttempts = 10
+
+// listenTCP занимает порт и возвращает фактически открытый номер порта
+func listenTCP(port string) (net.Listener, string, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid PORT %q: %w", port, err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		addr := strconv.Itoa(n + attempt)
+		ln, err := listenConfig().Listen(context.Background(), "tcp", ":"+addr)
+		if err == nil {
+			if attempt > 0 {
+				log.Printf("⚠️  Port %d is in use, listening on %s instead (PORT_AUTO_INCREMENT)", n, addr)
+			}
+			return ln, addr, nil
+		}
+
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, "", err
+		}
+		if !portAutoIncrement || attempt+1 >= maxPortAttempts {
+			return nil, "", fmt.Errorf("port %s is already in use (set PORT or PORT_AUTO_INCREMENT=true): %w", addr, err)
+		}
+	}
+}
+
+// listenConfig задаёт период TCP keepalive (TCP_KEEPALIVE) для принятых
+// соединений. Он должен быть меньше idle-таймаутов между балансировщиком и
+// приложением (timeout server/client в HAProxy, keepalive_timeout у Nginx и
+// conntrack/NAT по пути), иначе мёртвые соединения обнаруживаются поздно.
+// 0 — значение Go по умолчанию (15s).
+func listenConfig() *net.ListenConfig {
+	return &net.ListenConfig{KeepAlive: envDuration("TCP_KEEPALIVE", 0)}
+}
+
+// proxyProtocol (ENABLE_PROXY_PROTOCOL) — HAProxy шлёт PROXY-заголовок (send-proxy /
+// send-proxy-v2), и адрес клиента берётся из него, а не из X-Forwarded-For
+var proxyProtocol = envBool("ENABLE_PROXY_PROTOCOL", false)
+
+// withProxyProtocol разбирает PROXY protocol v1/v2. Заголовок принимается только
+// от доверенных прокси (TRUSTED_PROXIES), иначе соединение отклоняется, чтобы
+// клиент не мог подменить свой адрес.
+func withProxyProtocol(ln net.Listener) net.Listener {
+	log.Println("🔌 PROXY protocol enabled on listener")
+
+	return &proxyproto.Listener{
+		Listener:          ln,
+		ReadHeaderTimeout: 5 * time.Second,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if tcpAddr, ok := upstream.(*net.TCPAddr); ok && isTrustedProxy(tcpAddr.IP) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+	}
+}
+
+// maxHeaderBytes (MAX_HEADER_BYTES) — предел размера заголовков запроса.
+// Стандартный 1 МБ заметно больше, чем пропускает Nginx (large_client_header_buffers
+// 4 8k), поэтому по умолчанию 64 КБ.
+var maxHeaderBytes = envInt("MAX_HEADER_BYTES", 64<<10)
+
+// enableH2C (ENABLE_H2C) — принимать HTTP/2 без TLS (h2c) наряду с HTTP/1.1
+var enableH2C = envBool("ENABLE_H2C", false)
+
+// configureH2C оборачивает обработчик сервера в h2c. ConfigureServer нужен,
+// чтобы srv.Shutdown корректно закрывал и HTTP/2-соединения.
+func configureH2C(srv *http.Server) error {
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	log.Println("🔀 HTTP/2 cleartext (h2c) enabled")
+	return nil
+}
+
+// serve обслуживает запросы до SIGINT/SIGTERM, затем корректно останавливает сервер.
+// Закрытие Unix-листенера удаляет файл сокета.
+func serve(srv *http.Server, ln net.Listener) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Снимаем файл готовности до дренирования, чтобы новые запросы сюда не шли
+	removeReadinessFile()
+
+	// Таймаут стоит согласовать с окном дренирования в балансировщике
+	timeout := envDuration("SHUTDOWN_TIMEOUT", 15*time.Second)
+	log.Printf("🛑 Shutting down server (waiting up to %v for in-flight requests)...", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("⚠️  Shutdown timeout reached with %d requests still active, forcing close", inFlight.Load())
+			return srv.Close()
+		}
+		return err
+	}
+
+	log.Println("👋 Server stopped")
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Мультитенантный режим: пул БД выбирается по заголовку X-Tenant.
+// DSN тенанта берётся из TENANT_DSNS ("acme=postgres://...,beta=postgres://...")
+// или из шаблона TENANT_DSN_TEMPLATE, где {tenant} заменяется на id тенанта.
+// Если не задано ни то, ни другое, заголовок игнорируется и всё идёт в основной пул.
+// Схема в базах тенантов должна быть подготовлена заранее.
+var (
+	tenantDSNs        = parseTenantDSNs(getenv("TENANT_DSNS"))
+	tenantDSNTemplate = getenv("TENANT_DSN_TEMPLATE")
+	tenantMaxPools    = envInt("TENANT_MAX_POOLS", 100)
+
+	tenantPoolsMu sync.Mutex
+	tenantPools   = map[string]*sql.DB{}
+)
+
+var tenantIDRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// errTenantPoolLimit — открыто TENANT_MAX_POOLS пулов, новый тенант не помещается
+var errTenantPoolLimit = errors.New("tenant pool limit reached")
+
+func parseTenantDSNs(raw string) map[string]string {
+	dsns := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		id, dsn, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || id == "" || dsn == "" {
+			continue
+		}
+		dsns[strings.ToLower(id)] = dsn
+	}
+	return dsns
+}
+
+func multiTenant() bool {
+	return len(tenantDSNs) > 0 || tenantDSNTemplate != ""
+}
+
+// tenantPool возвращает закэшированный пул тенанта, открывая его при первом обращении
+func tenantPool(tenant string) (*sql.DB, error) {
+	tenantPoolsMu.Lock()
+	defer tenantPoolsMu.Unlock()
+
+	if pool, ok := tenantPools[tenant]; ok {
+		return pool, nil
+	}
+
+	dsn, ok := tenantDSNs[tenant]
+	if !ok && tenantDSNTemplate != "" {
+		dsn, ok = strings.ReplaceAll(tenantDSNTemplate, "{tenant}", tenant), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", tenant)
+	}
+
+	// Шаблон принимает любой id, поэтому число пулов ограничено
+	if len(tenantPools) >= tenantMaxPools {
+		return nil, fmt.Errorf("%w (%d)", errTenantPoolLimit, tenantMaxPools)
+	}
+
+	pool, err := openPool(dsn)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(pool)
+
+	tenantPools[tenant] = pool
+	log.Printf("🏢 Opened pool for tenant %s: %s", tenant, maskPassword(dsn))
+	return pool, nil
+}
+
+// withTenant кладёт в контекст пул тенанта из X-Tenant (в мультитенантном режиме)
+func withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Tenant")))
+		if !multiTenant() || tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !tenantIDRe.MatchString(tenant) {
+			writeError(w, http.StatusBadRequest, errCodeUnknownTenant, "Invalid X-Tenant header")
+			return
+		}
+
+		pool, err := tenantPool(tenant)
+		if errors.Is(err, errTenantPoolLimit) {
+			// Тенант известен, но у сервера кончились пулы — это не ошибка клиента
+			log.Printf("⚠️  Tenant %s rejected: %v", tenant, err)
+			w.Header().Set("Retry-After", "30")
+			writeError(w, http.StatusServiceUnavailable, errCodeTenantPoolExhausted, "Tenant pool limit reached")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeUnknownTenant, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantPoolKey, pool)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func tenantPoolFrom(ctx context.Context) *sql.DB {
+	pool, _ := ctx.Value(tenantPoolKey).(*sql.DB)
+	return pool
+}
+
+// writeDB — пул для записи: пул тенанта, если он выбран, иначе основной
+// (или резервный после переключения)
+func writeDB(r *http.Request) *sql.DB {
+	if pool := tenantPoolFrom(r.Context()); pool != nil {
+		return withDBRole(r, "write", pool)
+	}
+	return withDBRole(r, "write", activeDB())
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantPoolLimitIs503(t *testing.T) {
+	prevTemplate, prevMax := tenantDSNTemplate, tenantMaxPools
+	tenantDSNTemplate, tenantMaxPools = "postgres://app@db-{tenant}/app", 0
+	t.Cleanup(func() { tenantDSNTemplate, tenantMaxPools = prevTemplate, prevMax })
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request passed the tenant pool limit")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	withTenant(next).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is not set")
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != errCodeTenantPoolExhausted {
+		t.Errorf("code = %q, want %q", body.Code, errCodeTenantPoolExhausted)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// UpsertResult — итог POST /users/upsert
+type UpsertResult struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+}
+
+// upsertUsersHandler синхронизирует пользователей из внешнего источника:
+// один INSERT ... ON CONFLICT (email) DO UPDATE на весь пакет.
+// С ?partial=true каждый элемент обрабатывается отдельно (writePartialBatch).
+func upsertUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	if dryRun {
+		writeError(w, http.StatusServiceUnavailable, errCodeReadOnly, "Service is in read-only mode (DB_DRY_RUN)")
+		return
+	}
+
+	pool := writeDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	if partialRequested(r) {
+		writePartialBatch(w, r, pool, upsertBatchItem)
+		return
+	}
+
+	inputs, ok := readBatch(w, r)
+	if !ok {
+		return
+	}
+
+	// PostgreSQL не даёт ON CONFLICT DO UPDATE затронуть одну строку дважды
+	// в одном запросе, поэтому повторы email схлопываем: побеждает последний
+	inputs = dedupeByEmail(inputs)
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	var (
+		result           UpsertResult
+		created, updated []User
+	)
+	err := withPinnedUserLimitTx(ctx, pool, func(tx *sql.Tx) error {
+		created, updated = nil, nil // транзакция может повторяться
+		for _, chunk := range batchChunks(inputs) {
+			c, u, err := upsertChunk(ctx, tx, chunk)
+			if err != nil {
+				return err
+			}
+			created = append(created, c...)
+			updated = append(updated, u...)
+		}
+		result = UpsertResult{Inserted: len(created), Updated: len(updated)}
+
+		// Лимит проверяем после вставки: сколько строк новых, заранее неизвестно
+		if result.Inserted > 0 {
+			return checkUserLimit(ctx, tx, 0)
+		}
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, errUserLimitReached) {
+			writeError(w, http.StatusInsufficientStorage, errCodeUserLimit,
+				fmt.Sprintf("User limit of %d reached", maxUsers))
+		} else {
+			writeDBError(w, r, err, "Failed to upsert users")
+		}
+		return
+	}
+
+	markWrite(w)
+	emitUserEvent(eventUserCreated, created...)
+	emitUserEvent(eventUserUpdated, updated...)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// upsertChunk выполняет upsert одной части пакета и делит строки на вставленные
+// и обновлённые
+func upsertChunk(ctx context.Context, tx *sql.Tx, chunk []UserInput) (created, updated []User, err error) {
+	query, args := upsertQuery(chunk)
+	rows, err := dbQuery(ctx, tx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			inserted bool
+			user     User
+		)
+		if err := rows.Scan(&inserted, &user.ID, &user.Name, &user.Email, &user.CreatedAt.Time, &user.UpdatedAt.Time); err != nil {
+			return nil, nil, err
+		}
+		if inserted {
+			created = append(created, user)
+		} else {
+			updated = append(updated, user)
+		}
+	}
+	return created, updated, rows.Err()
+}
+
+// upsertQuery строит INSERT ... ON CONFLICT (email) DO UPDATE.
+// xmax = 0 только у только что вставленной строки — так отличаем insert от update.
+func upsertQuery(inputs []UserInput) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO users (name, email) VALUES ")
+	args := writeBatchValues(&sb, inputs)
+	sb.WriteString(" ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name, updated_at = CURRENT_TIMESTAMP RETURNING (xmax = 0) AS inserted, " + userColumns)
+
+	return sb.String(), args
+}
+
+// dedupeByEmail оставляет последнюю запись для каждого email, сохраняя порядок
+func dedupeByEmail(inputs []UserInput) []UserInput {
+	last := make(map[string]int, len(inputs))
+	for i, in := range inputs {
+		last[in.Email] = i
+	}
+	if len(last) == len(inputs) {
+		return inputs
+	}
+
+	out := make([]UserInput, 0, len(last))
+	for i, in := range inputs {
+		if last[in.Email] == i {
+			out = append(out, in)
+		}
+	}
+	return out
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idAsString (ID_AS_STRING) — отдавать id строкой: JavaScript теряет точность
+// на целых больше 2^53, что станет возможным после перехода на bigint
+var idAsString = envBool("ID_AS_STRING", false)
+
+// userID — идентификатор пользователя в ответах API
+type userID int64
+
+func (id userID) MarshalJSON() ([]byte, error) {
+	if idAsString {
+		return []byte(`"` + strconv.FormatInt(int64(id), 10) + `"`), nil
+	}
+	return []byte(strconv.FormatInt(int64(id), 10)), nil
+}
+
+// timeFormat (TIME_FORMAT) — формат отметок времени в JSON:
+// rfc3339 (по умолчанию), unix (секунды) или unix_ms (миллисекунды)
+var timeFormat = envTimeFormat("TIME_FORMAT")
+
+func envTimeFormat(key string) string {
+	switch v := envOrDefault(key, "rfc3339"); v {
+	case "rfc3339", "unix", "unix_ms":
+		return v
+	default:
+		log.Printf("⚠️  Invalid value %q for %s, using default rfc3339", v, key)
+		return "rfc3339"
+	}
+}
+
+// jsonTime — отметка времени в ответах API, сериализуется по TIME_FORMAT
+type jsonTime struct {
+	time.Time
+}
+
+func (t jsonTime) MarshalJSON() ([]byte, error) {
+	switch timeFormat {
+	case "unix":
+		return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+	case "unix_ms":
+		return []byte(strconv.FormatInt(t.UnixMilli(), 10)), nil
+	default:
+		return t.Time.MarshalJSON()
+	}
+}
+
+// userColumns — колонки, которые читает scanUser
+const userColumns = "id, name, email, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt.Time, &user.UpdatedAt.Time)
+	return user, err
+}
+
+// userByEmailHandler — GET /users/by-email?email=... для сценариев логина
+func userByEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	email := normalizeEmail(r.URL.Query().Get("email"))
+	if !validEmail(email) {
+		writeError(w, http.StatusBadRequest, errCodeValidation, "A valid email query parameter is required")
+		return
+	}
+
+	// HEAD-пробам мониторинга не нужен пользователь — не ходим в БД
+	if r.Method == http.MethodHead {
+		writeHead(w, http.StatusOK, "application/json")
+		return
+	}
+
+	pool := readDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		writeDBError(w, r, err, "Database query failed")
+		return
+	}
+	defer conn.Close()
+
+	user, err := scanUser(dbQueryRow(ctx, conn,
+		"SELECT "+userColumns+" FROM users WHERE email = $1", email))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, errCodeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "Database query failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// randomUserHandler — GET /users/random: случайный пользователь для нагрузочных
+// и демо-сценариев. ORDER BY random() читает всю таблицу, поэтому берём
+// случайный id между min(id) и max(id) и первую строку не меньше его — оба
+// предела и поиск идут по первичному ключу. Из-за дыр в id выборка не строго
+// равномерная, для генерации трафика это неважно.
+func randomUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	// HEAD-пробам мониторинга не нужен пользователь — не ходим в БД
+	if r.Method == http.MethodHead {
+		writeHead(w, http.StatusOK, "application/json")
+		return
+	}
+
+	pool := readDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	conn, err := acquireConn(ctx, pool)
+	if err != nil {
+		writeDBError(w, r, err, "Database query failed")
+		return
+	}
+	defer conn.Close()
+
+	user, err := scanUser(dbQueryRow(ctx, conn,
+		`SELECT `+userColumns+` FROM users
+		WHERE id >= (SELECT min(id) + floor(random() * (max(id) - min(id) + 1))::bigint FROM users)
+		ORDER BY id LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, errCodeUserNotFound, "No users yet")
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "Database query failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// patchableColumns — поля, которые можно менять через PATCH, в порядке
+// подстановки в UPDATE. Имена колонок берутся только отсюда.
+var patchableColumns = []string{"name", "email"}
+
+// UserPatch — тело PATCH /users/{id}; nil — поле не передано. Неизвестные
+// поля, как и у остальных обработчиков, отклоняются только с STRICT_JSON.
+type UserPatch struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+// column возвращает переданное значение колонки из patchableColumns
+func (p UserPatch) column(name string) *string {
+	switch name {
+	case "name":
+		return p.Name
+	case "email":
+		return p.Email
+	}
+	return nil
+}
+
+// patchUserHandler — PATCH /users/{id}: обновляются только переданные поля
+func patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		notFoundHandler(w, r)
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodPatch) {
+		return
+	}
+
+	if dryRun {
+		writeError(w, http.StatusServiceUnavailable, errCodeReadOnly, "Service is in read-only mode (DB_DRY_RUN)")
+		return
+	}
+
+	pool := writeDB(r)
+	if pool == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeDBUnavailable, "Database not connected")
+		return
+	}
+
+	var body UserPatch
+	if err := decodeJSON(r, &body); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	var sets []string
+	var args []interface{}
+	for _, column := range patchableColumns {
+		ptr := body.column(column)
+		if ptr == nil {
+			continue
+		}
+
+		value := *ptr
+		if strings.TrimSpace(value) == "" {
+			writeError(w, http.StatusBadRequest, errCodeValidation, fmt.Sprintf("Field %q must be a non-empty string", column))
+			return
+		}
+
+		if column == "email" {
+			value = normalizeEmail(value)
+			if !validEmail(value) {
+				writeError(w, http.StatusBadRequest, errCodeValidation, "Invalid email")
+				return
+			}
+		}
+
+		if errs := fieldLengthErrors(map[string]string{column: value}); errs != nil {
+			writeLengthError(w, "", errs)
+			return
+		}
+
+		if errs := junkFieldErrors(map[string]string{column: value}); errs != nil {
+			writeJunkError(w, "", errs)
+			return
+		}
+
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if len(sets) == 0 {
+		writeError(w, http.StatusBadRequest, errCodeValidation,
+			fmt.Sprintf("At least one of %s is required", strings.Join(patchableColumns, ", ")))
+		return
+	}
+
+	ctx, cancel := queryContext(r, queryTimeout.Get())
+	defer cancel()
+
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d RETURNING %s",
+		strings.Join(sets, ", "), len(args), userColumns)
+
+	var user User
+	err = withPinnedTx(ctx, pool, func(tx *sql.Tx) error {
+		var err error
+		user, err = scanUser(dbQueryRow(ctx, tx, query, args...))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, errCodeUserNotFound, "User not found")
+		return
+	}
+	if pqErr, ok := uniqueViolation(err); ok {
+		writeDuplicateError(w, pqErr)
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "Failed to update user")
+		return
+	}
+
+	markWrite(w)
+	emitUserEvent(eventUserUpdated, user)
+	writeJSON(w, http.StatusOK, user)
+}
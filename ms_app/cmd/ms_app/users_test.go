@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPatchUserFollowsStrictJSON(t *testing.T) {
+	useFakeDB(t, func(query string) (driver.Rows, error) {
+		return nil, errors.New("unexpected query: " + query)
+	})
+
+	for _, strict := range []bool{false, true} {
+		prev := strictJSON
+		strictJSON = strict
+
+		req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`{"nickname":"x"}`))
+		req.SetPathValue("id", "1")
+		rec := httptest.NewRecorder()
+		patchUserHandler(rec, req)
+		strictJSON = prev
+
+		var body ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("strict=%v: status = %d, want 400", strict, rec.Code)
+		}
+		// Без STRICT_JSON неизвестное поле пропускается, и в теле не остаётся полей
+		if got := body.Details["field"] == "nickname"; got != strict {
+			t.Errorf("strict=%v: unknown field reported = %v (%s)", strict, got, body.Error)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// normalizeEmail приводит email к виду, в котором он хранится в БД:
+// без пробелов по краям и в нижнем регистре. Так уникальное ограничение
+// не пропускает "Foo@Example.com" рядом с "foo@example.com".
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validEmail — адрес без отображаемого имени: "a@b.c", но не "A <a@b.c>"
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// queryInt читает неотрицательный целый query-параметр; пустой — 0
+func queryInt(r *http.Request, name string) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return v, nil
+}
+
+// Пределы длины совпадают с VARCHAR(100) в схеме; если колонки расширят
+// миграцией, пределы меняются через NAME_MAX_LENGTH / EMAIL_MAX_LENGTH
+var (
+	nameMaxLength  = envInt("NAME_MAX_LENGTH", 100)
+	emailMaxLength = envInt("EMAIL_MAX_LENGTH", 100)
+)
+
+// fieldLengthErrors проверяет длину полей в символах (как считает VARCHAR).
+// Возвращает сообщение по каждому слишком длинному полю или nil.
+func fieldLengthErrors(fields map[string]string) map[string]string {
+	var errs map[string]string
+	for field, value := range fields {
+		limit := nameMaxLength
+		if field == "email" {
+			limit = emailMaxLength
+		}
+
+		if n := utf8.RuneCountInString(value); n > limit {
+			if errs == nil {
+				errs = make(map[string]string)
+			}
+			errs[field] = fmt.Sprintf("must be at most %d characters, got %d", limit, n)
+		}
+	}
+	return errs
+}
+
+// Тексты ошибок валидации полей, общие для одиночных и пакетных запросов
+const (
+	msgFieldTooLong = "field too long"
+	msgFieldJunk    = "field contains only wildcard or whitespace characters"
+)
+
+// writeLengthError отвечает 400 с сообщением по каждому полю в details
+func writeLengthError(w http.ResponseWriter, prefix string, errs map[string]string) {
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{
+		Error:   prefix + msgFieldTooLong,
+		Code:    errCodeValidation,
+		Details: errs,
+	})
+}
+
+// strictInput (STRICT_INPUT) — отклонять name/email, состоящие только из
+// символов-шаблонов и пробелов ("%", "_ _"): такие строки ломают ILIKE-поиск
+var strictInput = envBool("STRICT_INPUT", false)
+
+// wildcardChars — шаблоны LIKE/ILIKE и glob, плюс пробельные символы
+const wildcardChars = "%_*?"
+
+// junkFieldErrors возвращает сообщение по каждому полю, в котором нет ничего,
+// кроме шаблонов и пробелов, или nil. Без STRICT_INPUT всегда nil.
+func junkFieldErrors(fields map[string]string) map[string]string {
+	if !strictInput {
+		return nil
+	}
+
+	var errs map[string]string
+	for field, value := range fields {
+		junk := strings.TrimFunc(value, func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune(wildcardChars, r)
+		}) == ""
+		if junk {
+			if errs == nil {
+				errs = make(map[string]string)
+			}
+			errs[field] = "must contain more than wildcard (% _ * ?) or whitespace characters"
+		}
+	}
+	return errs
+}
+
+// writeJunkError отвечает 400 на поля, отклонённые junkFieldErrors
+func writeJunkError(w http.ResponseWriter, prefix string, errs map[string]string) {
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{
+		Error:   prefix + msgFieldJunk,
+		Code:    errCodeValidation,
+		Details: errs,
+	})
+}
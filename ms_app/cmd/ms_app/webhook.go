@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Типы событий, которые отправляются на WEBHOOK_URL
+const (
+	eventUserCreated = "user.created"
+	eventUserUpdated = "user.updated"
+)
+
+// webhookEvent — тело POST-запроса на WEBHOOK_URL
+type webhookEvent struct {
+	Type      string   `json:"type"`
+	Timestamp jsonTime `json:"timestamp"`
+	Source    string   `json:"source"`
+	User      User     `json:"user"`
+}
+
+var (
+	// webhookURL (WEBHOOK_URL) — куда отправлять события об изменении
+	// пользователей; пусто — вебхуки выключены
+	webhookURL = getenv("WEBHOOK_URL")
+	// webhookRetries (WEBHOOK_MAX_RETRIES) — повторы после неудачной отправки
+	webhookRetries = envInt("WEBHOOK_MAX_RETRIES", 3)
+
+	// webhookQueue — очередь событий; nil, пока отправка не запущена
+	webhookQueue chan webhookEvent
+	// webhookSource — hostname инстанса в поле source
+	webhookSource string
+)
+
+// startWebhookSender запускает отправку событий в фоне. Очередь ограничена
+// (WEBHOOK_QUEUE_SIZE): если получатель не успевает, новые события
+// отбрасываются, а не копятся в памяти и не задерживают ответы API.
+func startWebhookSender() {
+	if webhookURL == "" {
+		return
+	}
+
+	webhookSource, _ = os.Hostname()
+	webhookQueue = make(chan webhookEvent, envInt("WEBHOOK_QUEUE_SIZE", 1000))
+	client := &http.Client{Timeout: envDuration("WEBHOOK_TIMEOUT", 5*time.Second)}
+
+	// URL может содержать токен, в лог пишем только хост
+	if u, err := url.Parse(webhookURL); err == nil {
+		log.Printf("📣 Webhooks enabled, sending events to %s", u.Host)
+	}
+
+	// Один отправитель — события уходят в порядке изменений
+	go func() {
+		for event := range webhookQueue {
+			deliverWebhook(client, event)
+		}
+	}()
+}
+
+// emitUserEvent ставит события в очередь, не блокируя обработчик.
+// Вызывается только после успешного коммита.
+func emitUserEvent(eventType string, users ...User) {
+	if webhookQueue == nil {
+		return
+	}
+
+	now := jsonTime{clock.Now().UTC()}
+	for _, user := range users {
+		select {
+		case webhookQueue <- webhookEvent{Type: eventType, Timestamp: now, Source: webhookSource, User: user}:
+		default:
+			log.Printf("⚠️  Webhook queue is full, dropping %s event for user %d", eventType, user.ID)
+		}
+	}
+}
+
+// deliverWebhook отправляет событие с повторами и растущей паузой.
+// Ответы 4xx (кроме 429) не повторяются: получатель отверг само событие.
+func deliverWebhook(client *http.Client, event webhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("❌ Could not encode webhook event: %v", err)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := postWebhook(client, body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= webhookRetries {
+			log.Printf("❌ Webhook %s for user %d failed after %d attempt(s): %v",
+				event.Type, event.User.ID, attempt+1, err)
+			return
+		}
+
+		clock.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+// postWebhook делает одну попытку; retry — имеет ли смысл повторять
+func postWebhook(client *http.Client, body []byte) (retry bool, err error) {
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver responded %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+}
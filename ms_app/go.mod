@@ -2,4 +2,10 @@ module ms_app
 
 go 1.22.1
 
-require github.com/lib/pq v1.10.9 // indirect
+require (
+	github.com/lib/pq v1.10.9
+	github.com/pires/go-proxyproto v0.7.0
+	golang.org/x/net v0.33.0
+)
+
+require golang.org/x/text v0.21.0 // indirect